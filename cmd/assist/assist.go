@@ -0,0 +1,1765 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/busoc/assist"
+	"github.com/midbel/toml"
+)
+
+type Assist struct {
+	Alliop      string          `toml:"alliop"`
+	Instr       string          `toml:"instrlist"`
+	Trajectory  string          `toml:"path"`
+	Resolution  assist.Duration `toml:"resolution"`
+	KeepComment bool            `toml:"keep-comment"`
+	Ignore      bool            `toml:"ignore"`
+	MinGap      assist.Duration `toml:"min-gap"`
+	Conflict    string          `toml:"conflict"`
+	Blackouts   []assist.Period `toml:"blackouts"`
+	Workers     int             `toml:"workers"`
+	MaxLine     int             `toml:"max-line"`
+	StartDelay  assist.Duration `toml:"start-delay"`
+	StartPad    assist.Duration `toml:"start-padding"`
+	Rounding    string          `toml:"rounding"`
+	CmdPerBlock bool            `toml:"cmd-per-block"`
+	Comment     string          `toml:"comment"`
+	NoArgs      bool            `toml:"no-args-comment"`
+
+	// time range of the schedule. base-time and end-time given on the command
+	// line replace the ones of the configuration
+	BaseTime time.Time `toml:"base-time"`
+	EndTime  time.Time `toml:"end-time"`
+
+	ROC assist.RocOption    `toml:"roc"`
+	CER assist.CerOption    `toml:"cer"`
+	ACS assist.AuroraOption `toml:"acs"`
+
+	Instruments []assist.InstrumentOption `toml:"instrument"`
+	Codes       map[string]string         `toml:"instruments"`
+	Columns     columns                   `toml:"columns"`
+
+	Progress assist.ProgressFunc `toml:"-"`
+	Orbit    assist.Orbit        `toml:"-"`
+
+	FailEmpty   bool     `toml:"-"`
+	Precise     bool     `toml:"-"`
+	Summary     string   `toml:"-"`
+	SourceLines bool     `toml:"-"`
+	RejectEmpty bool     `toml:"-"`
+	Strict      bool     `toml:"-"`
+	Trace       bool     `toml:"-"`
+	SecOfDay    bool     `toml:"-"`
+	Absolute    bool     `toml:"-"`
+	Only        []string `toml:"-"`
+	Color       bool     `toml:"-"`
+	Backup      bool     `toml:"-"`
+	PassHeader  bool     `toml:"-"`
+
+	*assist.Schedule `toml:"-"`
+
+	commands map[string]command
+	inline   map[string]string
+	stdin    bool
+}
+
+// columns gives the position (starting at 1) of the eclipse and SAA columns in
+// the trajectory.
+type columns struct {
+	Eclipse int `toml:"eclipse"`
+	Saa     int `toml:"saa"`
+}
+
+func (c columns) Columns() assist.Columns {
+	return assist.Columns{
+		Eclipse: c.Eclipse - 1,
+		Saa:     c.Saa - 1,
+	}
+}
+
+func Default() *Assist {
+	return &Assist{
+		ROC:         assist.RocDefault,
+		CER:         assist.CerDefault,
+		ACS:         assist.AuroraDefault,
+		Instr:       INSTR,
+		Alliop:      ALLIOP,
+		KeepComment: true,
+		Comment:     CommentPrefix,
+		MaxLine:     MaxLineSize,
+		StartDelay:  assist.Duration{Duration: DefaultStartDelay},
+		StartPad:    assist.Duration{Duration: assist.Five},
+		Resolution:  assist.NewDuration(1),
+		Columns: columns{
+			Eclipse: assist.PredictEclipseIndex + 1,
+			Saa:     assist.PredictSaaIndex + 1,
+		},
+	}
+}
+
+func (a *Assist) Load(file string) error {
+	if err := a.Decode(file); err != nil {
+		return err
+	}
+	return a.Open()
+}
+
+func (a *Assist) LoadAndFilter(file string, base time.Time) error {
+	if err := a.Decode(file); err != nil {
+		return err
+	}
+	return a.OpenAndFilter(base)
+}
+
+// Decode reads the configuration from file. When file is "-", the
+// configuration is read from stdin and the trajectory can then only be read
+// from a file.
+func (a *Assist) Decode(file string) error {
+	var err error
+	if file == "-" {
+		a.stdin = true
+		err = toml.Decode(os.Stdin, a)
+	} else {
+		err = toml.DecodeFile(file, a)
+	}
+	if err != nil {
+		return err
+	}
+	a.Override()
+	if err := a.loadInline(); err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	for _, i := range a.Instruments {
+		if err := i.CheckName(); err != nil {
+			return err
+		}
+		if _, ok := seen[i.Name]; ok {
+			return assist.BadUsage(fmt.Sprintf("instrument: %s defined more than once", i.Name))
+		}
+		seen[i.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (a *Assist) loadInline() error {
+	sets := []struct {
+		Name string
+		*assist.Fileset
+	}{
+		{Name: "roc", Fileset: &a.ROC.Fileset},
+		{Name: "cer", Fileset: &a.CER.Fileset},
+		{Name: "acs", Fileset: &a.ACS.Fileset},
+	}
+	for i := range a.Instruments {
+		sets = append(sets, struct {
+			Name string
+			*assist.Fileset
+		}{Name: a.Instruments[i].Name, Fileset: &a.Instruments[i].Fileset})
+	}
+	for _, s := range sets {
+		f, err := s.Inline(s.Name)
+		if err != nil {
+			return err
+		}
+		*s.Fileset = f
+		if f.OnCmd == "" && f.OffCmd == "" {
+			continue
+		}
+		if a.inline == nil {
+			a.inline = make(map[string]string)
+		}
+		if f.OnCmd != "" {
+			a.inline[f.On] = f.OnCmd
+		}
+		if f.OffCmd != "" {
+			a.inline[f.Off] = f.OffCmd
+		}
+	}
+	return nil
+}
+
+func (a *Assist) openCommands(file string) (io.ReadCloser, error) {
+	if body, ok := a.inline[file]; ok {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		return nil, assist.CheckError(err, nil)
+	}
+	return r, nil
+}
+
+func (a *Assist) instrument(label string) (assist.InstrumentOption, bool) {
+	for _, i := range a.Instruments {
+		if on, off := i.Labels(); label == on || label == off {
+			return i, true
+		}
+	}
+	return assist.InstrumentOption{}, false
+}
+
+func (a *Assist) commandFiles() []string {
+	files := []string{
+		a.ROC.On,
+		a.ROC.Off,
+		a.CER.On,
+		a.CER.Off,
+		a.ACS.On,
+		a.ACS.Off,
+	}
+	for _, i := range a.Instruments {
+		files = append(files, i.On, i.Off)
+	}
+	return files
+}
+
+const (
+	EnvAlliop = "ASSIST_ALLIOP"
+	EnvInstr  = "ASSIST_INSTRLIST"
+	EnvPath   = "ASSIST_PATH"
+)
+
+func (a *Assist) Override() {
+	vs := []struct {
+		Env   string
+		Value *string
+	}{
+		{Env: EnvAlliop, Value: &a.Alliop},
+		{Env: EnvInstr, Value: &a.Instr},
+		{Env: EnvPath, Value: &a.Trajectory},
+	}
+	for _, v := range vs {
+		if str, ok := os.LookupEnv(v.Env); ok && str != "" {
+			*v.Value = str
+		}
+	}
+}
+
+func (a *Assist) Open() error {
+	var (
+		area = a.ACS.Area()
+		r    io.Reader
+		err  error
+	)
+	if a.Trajectory != "" {
+		f, err := os.Open(a.Trajectory)
+		if err != nil {
+			return assist.CheckError(err, nil)
+		}
+		defer f.Close()
+		r = f
+	} else {
+		if a.stdin {
+			return assist.BadUsage("trajectory can not be read from stdin when the configuration is")
+		}
+		r = os.Stdin
+	}
+	a.Schedule, err = assist.OpenReaderColumns(context.Background(), r, area, a.Columns.Columns(), a.Progress)
+	if err != nil {
+		return err
+	}
+	a.Schedule.Ignore = a.Ignore
+	a.Schedule.MinGap = a.MinGap.Duration
+	a.Schedule.Conflict = a.Conflict
+	a.Schedule.Blackouts = a.Blackouts
+	a.Schedule.Workers = a.Workers
+	a.Schedule.Instruments = a.Instruments
+	if a.Trace {
+		a.Schedule.Trace = traceEntry
+	}
+
+	if ps := a.Schedule.Removed(); len(ps) > 0 {
+		if a.RejectEmpty {
+			p := ps[0]
+			return assist.BadUsage(fmt.Sprintf("%s: zero duration %s at %s", a.Trajectory, p.Label, p.Starts.Format(timeFormat)))
+		}
+		log.Printf("removed %d zero duration period(s)", len(ps))
+	}
+	return a.checkSpacing()
+}
+
+func traceEntry(e assist.Entry, from time.Time, rule string) {
+	when := "-"
+	if !e.When.IsZero() {
+		when = e.When.Format(timeFormat)
+	}
+	log.Printf("trace: %s (%s %s): %s -> %s: %s", e.Label, e.Period.Label, e.Period.Starts.Format(timeFormat), from.Format(timeFormat), when, rule)
+}
+
+// checkSpacing compares the most frequent spacing of the rows of the trajectory
+// with the resolution given in the configuration.
+func (a *Assist) checkSpacing() error {
+	var (
+		res  = a.Resolution.Duration
+		diff = a.Schedule.Spacing - res
+	)
+	if a.Schedule.Spacing == 0 || res <= 0 {
+		return nil
+	}
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff*ResolutionTolerance <= res {
+		return nil
+	}
+	msg := fmt.Sprintf("trajectory rows are %s apart but resolution is %s", a.Schedule.Spacing, res)
+	if a.Strict {
+		return assist.BadUsage(msg)
+	}
+	log.Printf("warning: %s", msg)
+	return nil
+}
+
+func (a *Assist) OpenAndFilter(base time.Time) error {
+	return a.OpenAndFilterRange(base, time.Time{})
+}
+
+func (a *Assist) OpenAndFilterRange(starts, ends time.Time) error {
+	if err := a.Open(); err != nil {
+		return err
+	}
+	a.BaseTime, a.EndTime = starts, ends
+
+	var (
+		orig = a.Schedule
+		cut  []assist.Period
+	)
+	a.Schedule = orig.Filter(starts)
+	if !starts.IsZero() {
+		var (
+			es = len(orig.Eclipses) - len(a.Eclipses)
+			ss = len(orig.Saas) - len(a.Saas)
+			xs = len(orig.Auroras) - len(a.Auroras)
+		)
+		log.Printf("filtered before %s: %d eclipses, %d saas, %d auroras (kept: %d, %d, %d)", starts.Format(timeFormat), es, ss, xs, len(a.Eclipses), len(a.Saas), len(a.Auroras))
+	}
+	a.Schedule, cut = a.Schedule.FilterRange(time.Time{}, ends)
+	a.Schedule.Origin = starts
+	if !a.Orbit.IsZero() {
+		a.Schedule.Origin = a.Orbit.Epoch
+	}
+	for _, p := range cut {
+		log.Printf("%s truncated at %s (%s - %s)", p.Label, ends.Format(timeFormat), p.Starts.Format(timeFormat), p.Ends.Format(timeFormat))
+	}
+	if !a.CER.IsEmpty() && len(a.Saas) == 0 {
+		log.Printf("warning: CER: no SAA crossing in the trajectory, the CER commands will not be scheduled")
+	}
+	return nil
+}
+
+func (a *Assist) Check() error {
+	sets := []struct {
+		Name string
+		assist.Fileset
+	}{
+		{Name: "roc", Fileset: a.ROC.Fileset},
+		{Name: "cer", Fileset: a.CER.Fileset},
+		{Name: "acs", Fileset: a.ACS.Fileset},
+	}
+	for _, i := range a.Instruments {
+		sets = append(sets, struct {
+			Name string
+			assist.Fileset
+		}{Name: i.Name, Fileset: i.Fileset})
+	}
+	for _, s := range sets {
+		if s.IsEmpty() {
+			continue
+		}
+		if s.On == "" || s.Off == "" {
+			return assist.MissingFile(s.Name)
+		}
+		if err := s.Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Assist) WarnSettings() {
+	for _, w := range a.ROC.Inconsistencies() {
+		log.Printf("warning: ROC: %s", w)
+	}
+	for _, w := range a.CER.Inconsistencies() {
+		log.Printf("warning: CER: %s", w)
+	}
+	for _, w := range a.ACS.Inconsistencies() {
+		log.Printf("warning: ACS: %s", w)
+	}
+}
+
+// CheckModes checks the values of the options only accepting a fixed set of
+// modes or rules.
+func (a *Assist) CheckModes() error {
+	if err := assist.CheckConflict(a.Conflict); err != nil {
+		return err
+	}
+	if err := CheckRounding(a.Rounding); err != nil {
+		return err
+	}
+	if err := assist.CheckMaxRule(a.ROC.MaxRule); err != nil {
+		return err
+	}
+	if err := assist.CheckCrossing(a.ROC.Crossing); err != nil {
+		return err
+	}
+	if err := assist.CheckCrossing(a.CER.Crossing); err != nil {
+		return err
+	}
+	if err := assist.CheckAlgorithm(a.CER.Algorithm); err != nil {
+		return err
+	}
+	if err := assist.CheckAnchor(a.ROC.Anchor); err != nil {
+		return err
+	}
+	if err := assist.CheckAccept(a.ACS.AcceptRule); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Assist) Validate() error {
+	if a.Trajectory != "" {
+		i, err := os.Stat(a.Trajectory)
+		if err != nil {
+			return assist.CheckError(err, nil)
+		}
+		if !i.Mode().IsRegular() {
+			return assist.BadUsage(fmt.Sprintf("%s: not a regular file", a.Trajectory))
+		}
+	}
+	if err := a.Check(); err != nil {
+		return err
+	}
+	if err := a.CheckModes(); err != nil {
+		return err
+	}
+	if a.StartPad.Duration < 0 {
+		return assist.BadUsage(fmt.Sprintf("start-padding should not be negative (%s)", a.StartPad.Duration))
+	}
+	if err := a.Columns.Columns().Check(); err != nil {
+		return err
+	}
+	for i, r := range a.ACS.Areas {
+		if r.IsZero() || !r.IsValid() {
+			return assist.BadUsage(fmt.Sprintf("ACS: invalid area #%d (%s)", i+1, r))
+		}
+	}
+	for i, b := range a.Blackouts {
+		if !b.Ends.After(b.Starts) {
+			return assist.BadUsage(fmt.Sprintf("invalid blackout #%d (%s - %s)", i+1, b.Starts.Format(timeFormat), b.Ends.Format(timeFormat)))
+		}
+	}
+	return nil
+}
+
+func (a *Assist) Create() error {
+	if err := a.loadCommands(); err != nil {
+		return err
+	}
+	a.printSettings()
+	var (
+		w      io.Writer
+		f      *pendingFile
+		digest = md5.New()
+	)
+	if a.Alliop == "" {
+		a.Alliop = "alliop"
+		w = io.MultiWriter(digest, os.Stdout)
+	} else {
+		var err error
+		if f, err = createPending(a.Alliop, a.Backup); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = io.MultiWriter(f, digest)
+	}
+
+	es, rpt, err := a.Schedule.ScheduleReport(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	if n := len(rpt.Dropped); n > 0 {
+		log.Printf("dropped %d blocks", n)
+	}
+	for _, d := range rpt.Dropped {
+		log.Printf("%s dropped (%s): %s - %s", d.Label, d.Reason, d.Starts.Format(timeFormat), d.Ends.Format(timeFormat))
+	}
+	if str := skippedAuroras(rpt.Skipped); str != "" {
+		log.Print(str)
+	}
+	if rpt.Peak > 1 {
+		log.Printf("peak concurrency: %d instruments on in %d window(s)", rpt.Peak, len(rpt.PeakWindows))
+	}
+	if len(es) == 0 {
+		if err := a.emptySchedule(rpt); err != nil {
+			return err
+		}
+		// the previous schedule is replaced: the alliop only has its preamble
+		// and metadata and the instrlist is empty
+		log.Printf("no command scheduled")
+		a.writePreamble(w, a.BaseTime)
+		if _, err := a.writeMetadata(w); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "# no command scheduled")
+		if err := a.writeList(nil); err != nil {
+			return err
+		}
+		if f == nil {
+			return nil
+		}
+		return f.Commit()
+	}
+	a.printRanges(es)
+	if d := es[0].When.Sub(a.BaseTime); !a.BaseTime.IsZero() && a.StartDelay.Duration > 0 && d > a.StartDelay.Duration {
+		log.Printf("warning: first command scheduled %s after base time %s (start-delay: %s)", d, a.BaseTime.Format(timeFormat), a.StartDelay.Duration)
+	}
+
+	base := a.roundTime(es[0].When.Add(-a.StartPad.Duration))
+	a.writePreamble(w, base)
+	ps, err := a.writeMetadata(w)
+	if err != nil {
+		return err
+	}
+
+	ms, err := a.writeSchedule(w, es, base)
+	if err != nil {
+		return err
+	}
+
+	for n, c := range ms {
+		log.Printf("%s scheduled: %d", n, c.Count)
+	}
+
+	var (
+		rocdur = ms[assist.ROCON].Duration + ms[assist.ROCOFF].Duration
+		cerdur = ms[assist.CERON].Duration + ms[assist.CEROFF].Duration
+		acsdur = ms[assist.ACSON].Duration + ms[assist.ACSOFF].Duration
+	)
+	log.Printf("MXGS-ROC total time: %s", rocdur)
+	log.Printf("MMIA-CER total time: %s", cerdur)
+	log.Printf("ASIM-ACS total time: %s", acsdur)
+
+	for _, i := range a.Instruments {
+		on, off := i.Labels()
+		log.Printf("%s total time: %s", i.Name, ms[on].Duration+ms[off].Duration)
+	}
+	log.Printf("md5 %s: %x", a.Alliop, digest.Sum(nil))
+
+	if a.Summary != "" {
+		s := summary{
+			Version:   Version,
+			Execution: ExecutionTime,
+			Start:     base,
+			Files:     ps,
+			Scheduled: make(map[string]int),
+			Periods:   make(map[string]periodSummary),
+			Dropped:   len(rpt.Dropped),
+			Skipped:   rpt.Skipped,
+		}
+		s.Alliop.File = a.Alliop
+		s.Alliop.MD5 = fmt.Sprintf("%x", digest.Sum(nil))
+		for n, c := range ms {
+			s.Scheduled[n] = c.Count
+		}
+		for n, u := range assist.PeriodStats(a.Schedule) {
+			s.Periods[n] = periodSummary{
+				Count:    u.Count,
+				Duration: u.Duration.String(),
+			}
+		}
+		if err := a.writeSummary(s); err != nil {
+			return err
+		}
+	}
+	if err := a.writeList(ms); err != nil {
+		return err
+	}
+	if f == nil {
+		return nil
+	}
+	return f.Commit()
+}
+
+func (a *Assist) PrintSettings() error {
+	return nil
+}
+
+func (a *Assist) PrintPeriods() error {
+	const pattern = "%3d | %-8s | %s | %s | %s"
+	timefmt := a.listFormat()
+	for i, p := range a.Periods() {
+		fmt.Printf(pattern, i, p.Label, p.Starts.Format(timefmt), p.Ends.Format(timefmt), p.Duration())
+		if !a.Orbit.IsZero() {
+			fmt.Printf(" | orbit %d", a.Orbit.Number(p.Starts))
+		}
+		if p.Area != "" {
+			fmt.Printf(" | area %s", p.Area)
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	st := assist.PeriodStats(a.Schedule)
+	for _, n := range []string{"eclipse", "saa", "aurora"} {
+		u := st[n]
+		fmt.Printf("%s total time: %s (%d)", n, u.Duration, u.Count)
+		fmt.Println()
+	}
+	return nil
+}
+
+func (a *Assist) PrintTimeline(step time.Duration) error {
+	const (
+		width   = 96
+		timefmt = "2006-01-02T15:04"
+	)
+	if step <= 0 {
+		return assist.BadUsage("timeline step should be greater than 0")
+	}
+	es, err := a.Schedule.Schedule(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	rows := []struct {
+		Label   string
+		Periods []assist.Period
+	}{
+		{Label: "eclipse", Periods: a.Eclipses},
+		{Label: "saa", Periods: a.Saas},
+		{Label: assist.InstrROC},
+		{Label: assist.InstrCER},
+		{Label: assist.InstrACS},
+	}
+	for _, i := range a.Instruments {
+		rows = append(rows, struct {
+			Label   string
+			Periods []assist.Period
+		}{Label: i.Name})
+	}
+	for _, b := range assist.Blocks(es, a.ROC, a.CER, a.ACS, a.Instruments...) {
+		for i := range rows {
+			if rows[i].Label == b.Label {
+				rows[i].Periods = append(rows[i].Periods, b)
+			}
+		}
+	}
+	var starts, ends time.Time
+	for _, r := range rows {
+		for _, p := range r.Periods {
+			if starts.IsZero() || p.Starts.Before(starts) {
+				starts = p.Starts
+			}
+			if ends.IsZero() || p.Ends.After(ends) {
+				ends = p.Ends
+			}
+		}
+	}
+	if starts.IsZero() {
+		return nil
+	}
+	starts = starts.Truncate(step)
+	for at := starts; at.Before(ends); at = at.Add(step * width) {
+		fmt.Printf("%-7s | %s (1 column = %s)", "", at.Format(timefmt), step)
+		fmt.Println()
+		for _, r := range rows {
+			var (
+				line strings.Builder
+				w    = assist.Period{Starts: at, Ends: at.Add(step)}
+			)
+			for i := 0; i < width && w.Starts.Before(ends); i++ {
+				c := byte('.')
+				for _, p := range r.Periods {
+					if p.Starts.Before(w.Ends) && p.Ends.After(w.Starts) {
+						c = '#'
+						break
+					}
+				}
+				line.WriteByte(c)
+				w.Starts, w.Ends = w.Ends, w.Ends.Add(step)
+			}
+			fmt.Printf("%-7s | %s", r.Label, line.String())
+			fmt.Println()
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func (a *Assist) listFormat() string {
+	if a.Precise {
+		return timeFormat
+	}
+	return listFormat
+}
+
+func (a *Assist) PrintEntries() error {
+	const (
+		hdrpat = "%3s | %s | %-9s | %-9s | %-*s | %-*s"
+		rowpat = "%3d | %s | %-9s | %-9d | %-*s | %-*s"
+	)
+	var (
+		timefmt = a.listFormat()
+		width   = len(timefmt) + 1
+	)
+	es, rpt, err := a.Schedule.ScheduleReport(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	if len(es) == 0 {
+		return a.emptySchedule(rpt)
+	}
+	first, last := es[0], es[len(es)-1]
+	fmt.Printf(hdrpat, "#", "?", "TYPE", a.secondsLabel()+" (GPS)", width, "START (GMT)", width, "END (GMT)")
+	if !a.Orbit.IsZero() {
+		fmt.Printf(" | %-6s", "ORBIT")
+	}
+	fmt.Println()
+	start := first.When.Add(-a.StartPad.Duration)
+	fmt.Printf(rowpat, 0, " ", "SCHEDULE", a.seconds(start), width, start.Format(timefmt), width, last.When.Format(timefmt))
+	if !a.Orbit.IsZero() {
+		fmt.Printf(" | %-6s", "-")
+	}
+	fmt.Println()
+
+	// the totals and the sections below only use the entries selected by -only
+	var xs []assist.Entry
+	for i, e := range es {
+		if !a.selected(e.Label) {
+			continue
+		}
+		xs = append(xs, e)
+		d := assist.EntryDuration(e, a.ROC, a.CER, a.ACS, a.Instruments...)
+		conflict := "-"
+		if e.Warning {
+			conflict = "!"
+		}
+		to := e.When.Add(d)
+		color := a.Color && e.Warning
+		if color {
+			fmt.Print(colorRed)
+		}
+		fmt.Printf(rowpat, i+1, conflict, e.Label, a.seconds(e.When), width, e.When.Format(timefmt), width, to.Format(timefmt))
+		if !a.Orbit.IsZero() {
+			fmt.Printf(" | %-6d", a.Orbit.Number(e.When))
+		}
+		if e.Period.Area != "" {
+			fmt.Printf(" | area %s", e.Period.Area)
+		}
+		if color {
+			fmt.Print(colorReset)
+		}
+		fmt.Println()
+	}
+	usage, days := assist.Usages(xs, a.ROC, a.CER, a.ACS, a.Instruments...)
+	var (
+		roc = usage[assist.InstrROC]
+		cer = usage[assist.InstrCER]
+		acs = usage[assist.InstrACS]
+	)
+	fmt.Printf("MXGS-ROC total time: %s (%d)", roc.Duration, roc.Count)
+	fmt.Println()
+	fmt.Printf("MMIA-CER total time: %s (%d)", cer.Duration, cer.Count)
+	fmt.Println()
+	fmt.Printf("MXGS-ACS total time: %s (%d)", acs.Duration, acs.Count)
+	fmt.Println()
+	for _, i := range a.Instruments {
+		u := usage[i.Name]
+		fmt.Printf("%s total time: %s (%d)", i.Name, u.Duration, u.Count)
+		fmt.Println()
+	}
+	printDailyUsage(days)
+	peak, windows := assist.Concurrency(xs, a.ROC, a.CER, a.ACS, a.Instruments...)
+	printConcurrency(peak, windows, timefmt)
+	a.printGaps(xs)
+	var ds []assist.Drop
+	for _, d := range rpt.Dropped {
+		if a.selectedInstrument(assist.Instrument(d.Label, a.Instruments...)) {
+			ds = append(ds, d)
+		}
+	}
+	printDropped(ds, timefmt)
+	if str := skippedAuroras(rpt.Skipped); str != "" && a.selectedInstrument(assist.InstrACS) {
+		fmt.Println()
+		fmt.Println(str)
+	}
+	return nil
+}
+
+// PrintConflicts prints the entries flagged with a conflict and the period
+// (block) they belong to. Entries keep their number in the full listing.
+func (a *Assist) PrintConflicts() error {
+	const (
+		hdrpat = "%3s | %-9s | %-9s | %-*s | %-18s | %s"
+		rowpat = "%3d | %-9s | %-9d | %-*s | %-18s | %s - %s"
+	)
+	var (
+		timefmt = a.listFormat()
+		width   = len(timefmt) + 1
+	)
+	es, err := a.Schedule.Schedule(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	var n int
+	fmt.Printf(hdrpat, "#", "TYPE", a.secondsLabel()+" (GPS)", width, "START (GMT)", "CONFLICT", "BLOCK (GMT)")
+	fmt.Println()
+	for i, e := range es {
+		if !e.Warning {
+			continue
+		}
+		n++
+		fmt.Printf(rowpat, i+1, e.Label, a.seconds(e.When), width, e.When.Format(timefmt), e.Conflict, e.Starts.Format(timefmt), e.Ends.Format(timefmt))
+		fmt.Println()
+	}
+	fmt.Println()
+	fmt.Printf("conflicts: %d/%d entries", n, len(es))
+	fmt.Println()
+	return nil
+}
+
+const (
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// isTerminal reports whether f is a character device (eg: a terminal).
+func isTerminal(f *os.File) bool {
+	i, err := f.Stat()
+	return err == nil && i.Mode()&os.ModeCharDevice != 0
+}
+
+func printDropped(ds []assist.Drop, timefmt string) {
+	if len(ds) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("dropped %d blocks:", len(ds))
+	fmt.Println()
+	for i, d := range ds {
+		fmt.Printf("%3d | %-9s | %-18s | %s | %s", i+1, d.Label, d.Reason, d.Starts.Format(timefmt), d.Ends.Format(timefmt))
+		fmt.Println()
+	}
+}
+
+// skippedAuroras gives the number of auroras rejected before their ACSON is
+// scheduled and the reasons they have been skipped.
+func skippedAuroras(skipped map[string]int) string {
+	var (
+		total   int
+		reasons []string
+	)
+	for r, n := range skipped {
+		total += n
+		reasons = append(reasons, fmt.Sprintf("%s: %d", r, n))
+	}
+	if total == 0 {
+		return ""
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("skipped %d auroras (%s)", total, strings.Join(reasons, ", "))
+}
+
+func (a *Assist) printGaps(es []assist.Entry) {
+	const bucket = time.Minute
+	if len(es) < 2 {
+		return
+	}
+	counts, buckets := a.gapBuckets(es, bucket)
+	var largest int
+	for _, n := range counts {
+		if n > largest {
+			largest = n
+		}
+	}
+	fmt.Println()
+	fmt.Println("gaps between blocks:")
+	for _, j := range buckets {
+		label := "< 0s"
+		if j >= 0 {
+			label = fmt.Sprintf("%s - %s", time.Duration(j)*bucket, time.Duration(j+1)*bucket)
+		}
+		bar := strings.Repeat("#", (counts[j]*40+largest-1)/largest)
+		fmt.Printf("%-15s | %4d | %s", label, counts[j], bar)
+		fmt.Println()
+	}
+}
+
+// gapBuckets counts the gaps between the blocks of es by buckets of the given
+// width (-1 for the blocks starting before the end of a previous one). The
+// blocks are grouped as in the report and a gap is measured from the latest end
+// of all the previous blocks, so that a short block inside a longer one is not
+// followed by a gap.
+func (a *Assist) gapBuckets(es []assist.Entry, width time.Duration) (map[int]int, []int) {
+	var (
+		counts  = make(map[int]int)
+		buckets []int
+		ends    time.Time
+	)
+	for i, b := range assist.Blocks(es, a.ROC, a.CER, a.ACS, a.Instruments...) {
+		if i > 0 {
+			var (
+				gap = b.Starts.Sub(ends)
+				j   = int(gap / width)
+			)
+			if gap < 0 {
+				j = -1
+			}
+			if _, ok := counts[j]; !ok {
+				buckets = append(buckets, j)
+			}
+			counts[j]++
+		}
+		if b.Ends.After(ends) {
+			ends = b.Ends
+		}
+	}
+	sort.Ints(buckets)
+	return counts, buckets
+}
+
+func printConcurrency(peak int, ws []assist.Period, timefmt string) {
+	if peak == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("peak concurrency: %d instrument(s) on (%d window(s))", peak, len(ws))
+	fmt.Println()
+	for _, w := range ws {
+		fmt.Printf("%-11s | %s | %s | %s", w.Label, w.Starts.Format(timefmt), w.Ends.Format(timefmt), w.Duration())
+		fmt.Println()
+	}
+}
+
+func printDailyUsage(ds []assist.DailyUsage) {
+	const (
+		hdrpat = "%-10s | %-3s | %-14s | %-14s | %-14s"
+		rowpat = "%-10s | %03d | %-14s | %-14s | %-14s"
+	)
+	if len(ds) == 0 {
+		return
+	}
+	usage := func(u assist.Usage) string {
+		return fmt.Sprintf("%s (%d)", u.Duration, u.Count)
+	}
+	fmt.Println()
+	fmt.Printf(hdrpat, "DAY", "DOY", "MXGS-ROC", "MMIA-CER", "MXGS-ACS")
+	fmt.Println()
+	for _, d := range ds {
+		var (
+			roc = d.Usage(assist.InstrROC)
+			cer = d.Usage(assist.InstrCER)
+			acs = d.Usage(assist.InstrACS)
+		)
+		fmt.Printf(rowpat, d.Day.Format("2006-01-02"), d.Day.YearDay(), usage(roc), usage(cer), usage(acs))
+		fmt.Println()
+	}
+}
+
+func (a *Assist) PrintEntriesJSON() error {
+	type entry struct {
+		Label    string    `json:"label"`
+		SOY      int64     `json:"soy"`
+		Starts   time.Time `json:"starts"`
+		Ends     time.Time `json:"ends"`
+		Warning  bool      `json:"warning"`
+		Conflict string    `json:"conflict,omitempty"`
+		Orbit    *int64    `json:"orbit,omitempty"`
+		Area     string    `json:"area,omitempty"`
+	}
+	es, err := a.Schedule.Schedule(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	xs := make([]entry, 0, len(es))
+	for _, e := range es {
+		if !a.selected(e.Label) {
+			continue
+		}
+		xs = append(xs, entry{
+			Label:    e.Label,
+			SOY:      e.SOY(),
+			Starts:   e.When,
+			Ends:     e.When.Add(assist.EntryDuration(e, a.ROC, a.CER, a.ACS, a.Instruments...)),
+			Warning:  e.Warning,
+			Conflict: e.Conflict,
+			Orbit:    a.orbitNumber(e.When),
+			Area:     e.Period.Area,
+		})
+	}
+	w := json.NewEncoder(os.Stdout)
+	w.SetIndent("", "  ")
+	return w.Encode(xs)
+}
+
+func (a *Assist) selected(label string) bool {
+	if len(a.Only) == 0 {
+		return true
+	}
+	for _, o := range a.Only {
+		if o == label {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedInstrument reports whether one of the labels selected with -only
+// belongs to instr. Dropped blocks are reported by instrument, not by label.
+func (a *Assist) selectedInstrument(instr string) bool {
+	if len(a.Only) == 0 {
+		return true
+	}
+	for _, o := range a.Only {
+		if assist.Instrument(o, a.Instruments...) == instr {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckLabels checks that every label of ls is the label of an entry that can be
+// scheduled (ROC, CER, ACS and the instrument sections).
+func (a *Assist) CheckLabels(ls []string) error {
+	known := []string{assist.ROCON, assist.ROCOFF, assist.CERON, assist.CEROFF, assist.ACSON, assist.ACSOFF}
+	for _, i := range a.Instruments {
+		on, off := i.Labels()
+		known = append(known, on, off)
+	}
+	for _, l := range ls {
+		var found bool
+		for _, k := range known {
+			if l == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return assist.BadUsage(fmt.Sprintf("%s: unknown label (expected: %s)", l, strings.Join(known, ", ")))
+		}
+	}
+	return nil
+}
+
+type coze struct {
+	Count    int
+	Duration time.Duration
+}
+
+func (a *Assist) orbitNumber(t time.Time) *int64 {
+	if a.Orbit.IsZero() {
+		return nil
+	}
+	n := a.Orbit.Number(t)
+	return &n
+}
+
+func (a *Assist) PrintEntriesICS() error {
+	const timefmt = "20060102T150405Z"
+	es, err := a.Schedule.Schedule(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format, args...)
+		io.WriteString(w, "\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//busoc//%s %s//EN", Program, Version)
+	for i, b := range assist.Blocks(es, a.ROC, a.CER, a.ACS, a.Instruments...) {
+		line("BEGIN:VEVENT")
+		line("UID:%s-%d-%d@%s", b.Label, b.Starts.Unix(), i, Program)
+		line("DTSTAMP:%s", ExecutionTime.Format(timefmt))
+		line("DTSTART:%s", b.Starts.UTC().Format(timefmt))
+		line("DTEND:%s", b.Ends.UTC().Format(timefmt))
+		line("SUMMARY:%s", b.Label)
+		line("DESCRIPTION:SOY (GPS): %d - %d", assist.SOY(b.Starts), assist.SOY(b.Ends))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return nil
+}
+
+// writeSchedule writes the commands of the entries of es scheduled after when.
+// The command files are not checked here: Check does it once before the
+// schedule is created.
+func (a *Assist) writeSchedule(w io.Writer, es []assist.Entry, when time.Time) (map[string]coze, error) {
+	var (
+		err error
+		cid = 1
+		ms  = make(map[string]coze)
+		ps  = make(map[assist.Period][]string)
+	)
+	if a.PassHeader {
+		// entries scheduled without a period (eg: classic CER) have no pass
+		for _, e := range es {
+			if !e.When.Before(when) && !e.Period.IsZero() {
+				ps[e.Period] = append(ps[e.Period], e.Label)
+			}
+		}
+	}
+
+	for _, e := range es {
+		if e.When.Before(when) {
+			continue
+		}
+		if ls, ok := ps[e.Period]; ok && !e.Period.IsZero() {
+			a.writePassHeader(w, e.Period, ls)
+			delete(ps, e.Period)
+		}
+		e.When = a.roundTime(e.When)
+		if d := a.startOffset(e.Label); d != 0 {
+			e.When = e.When.Add(d)
+			if e.When.Before(when) {
+				log.Printf("warning: %s: start-offset (%s) moves command before schedule start", e.Label, d)
+				e.When = when
+			}
+		}
+		var (
+			delta = e.When.Sub(when)
+			curr  = ms[e.Label]
+		)
+		switch e.Label {
+		case assist.ROCON:
+			cid, delta, err = a.writeCommands(w, a.ROC.On, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += a.ROC.TimeOn.Duration
+		case assist.ROCOFF:
+			cid, delta, err = a.writeCommands(w, a.ROC.Off, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += a.ROC.TimeOff.Duration
+		case assist.CERON:
+			cid, delta, err = a.writeCommands(w, a.CER.On, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += a.CER.TimeOn.Duration
+		case assist.CEROFF:
+			cid, delta, err = a.writeCommands(w, a.CER.Off, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += a.CER.TimeOff.Duration
+		case assist.ACSON:
+			cid, delta, err = a.writeCommands(w, a.ACS.On, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += a.ACS.For(e.Period).Time.Duration
+		case assist.ACSOFF:
+			cid, delta, err = a.writeCommands(w, a.ACS.Off, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += a.ACS.For(e.Period).Time.Duration
+		default:
+			i, ok := a.instrument(e.Label)
+			if !ok {
+				break
+			}
+			file, d := i.Off, i.TimeOff.Duration
+			if on, _ := i.Labels(); e.Label == on {
+				file, d = i.On, i.TimeOn.Duration
+			}
+			cid, delta, err = a.writeCommands(w, file, cid, e.When, delta)
+			curr.Count++
+			curr.Duration += d
+		}
+		if err != nil {
+			return nil, err
+		}
+		ms[e.Label] = curr
+	}
+	return ms, nil
+}
+
+const (
+	RoundTruncate = "truncate"
+	RoundNearest  = "round"
+	RoundCeil     = "ceil"
+)
+
+func CheckRounding(mode string) error {
+	switch mode {
+	case "", RoundTruncate, RoundNearest, RoundCeil:
+		return nil
+	default:
+		return assist.BadUsage(fmt.Sprintf("%s: unknown rounding mode", mode))
+	}
+}
+
+func (a *Assist) roundTime(t time.Time) time.Time {
+	switch a.Rounding {
+	case RoundTruncate:
+		return t.Truncate(time.Second)
+	case RoundNearest:
+		return t.Round(time.Second)
+	case RoundCeil:
+		if x := t.Truncate(time.Second); x.Before(t) {
+			return x.Add(time.Second)
+		}
+		return t
+	default:
+		return t
+	}
+}
+
+func (a *Assist) startOffset(label string) time.Duration {
+	switch label {
+	case assist.ROCON, assist.ROCOFF:
+		return a.ROC.Offset.Duration
+	case assist.CERON, assist.CEROFF:
+		return a.CER.Offset.Duration
+	case assist.ACSON, assist.ACSOFF:
+		return a.ACS.Offset.Duration
+	default:
+		if i, ok := a.instrument(label); ok {
+			return i.Offset.Duration
+		}
+		return 0
+	}
+}
+
+func (a *Assist) printSettings() {
+	log.Printf("%s-%s (build: %s)", Program, Version, BuildTime)
+	log.Printf("settings: AZM duration: %s (enter: %s, exit: %s)", a.ROC.TimeAZM.Duration, a.ROC.EnterAZM(), a.ROC.ExitAZM())
+	log.Printf("settings: ROCON time: %s", a.ROC.TimeOn.Duration)
+	log.Printf("settings: ROCOFF time: %s", a.ROC.TimeOff.Duration)
+	log.Printf("settings: CER time: %s", a.CER.SwitchTime.Duration)
+	log.Printf("settings: CERON time: %s", a.CER.TimeOn.Duration)
+	log.Printf("settings: CEROFF time: %s", a.CER.TimeOff.Duration)
+	log.Printf("settings: CER crossing duration: %s", a.CER.SaaCrossingTime.Duration)
+	log.Printf("settings: ACS night duration: %s", a.ACS.Night.Duration)
+	log.Printf("settings: ACS duration: %s", a.ACS.Time.Duration)
+	for _, r := range a.ACS.Areas {
+		if r.Name == "" || (r.Time.IsZero() && r.Night.IsZero()) {
+			continue
+		}
+		o := a.ACS.For(assist.Period{Area: r.Name})
+		log.Printf("settings: ACS %s night duration: %s", r.Name, o.Night.Duration)
+		log.Printf("settings: ACS %s duration: %s", r.Name, o.Time.Duration)
+	}
+	for _, i := range a.Instruments {
+		on, off := i.Labels()
+		log.Printf("settings: %s time: %s", on, i.TimeOn.Duration)
+		log.Printf("settings: %s time: %s", off, i.TimeOff.Duration)
+	}
+}
+
+func (a *Assist) emptySchedule(rpt assist.Report) error {
+	if !a.FailEmpty {
+		return nil
+	}
+	var causes []string
+	if rpt.Eclipses == 0 {
+		causes = append(causes, "no eclipse found after base-time")
+	}
+	if !a.ACS.IsEmpty() && rpt.Auroras == 0 {
+		causes = append(causes, "ACS areas match no aurora")
+	}
+	if len(rpt.Dropped) > 0 {
+		causes = append(causes, fmt.Sprintf("%d blocks dropped because of conflicts", len(rpt.Dropped)))
+	}
+	if a.ROC.IsEmpty() && a.CER.IsEmpty() && a.ACS.IsEmpty() && len(a.Instruments) == 0 {
+		causes = append(causes, "no command files configured")
+	}
+	msg := "no command scheduled"
+	if len(causes) > 0 {
+		msg += " (" + strings.Join(causes, ", ") + ")"
+	}
+	return assist.EmptySchedule(msg)
+}
+
+func (a *Assist) printRanges(es []assist.Entry) {
+	fst, lst := es[0], es[len(es)-1]
+	log.Printf("first command (%s) at %s (%d)", fst.Label, fst.When.Format(timeFormat), assist.SOY(fst.When))
+	log.Printf("last command (%s) at %s (%d)", lst.Label, lst.When.Format(timeFormat), assist.SOY(lst.When))
+}
+
+func (a *Assist) writePreamble(w io.Writer, when time.Time) {
+	var (
+		year  = when.AddDate(0, 0, -when.YearDay()+1).Truncate(assist.Day).Add(assist.Leap)
+		stamp = when.Add(assist.Leap)
+	)
+
+	fmt.Fprintf(w, "# %s-%s (build: %s)", Program, Version, BuildTime)
+	fmt.Fprintln(w)
+	if !a.NoArgs {
+		fmt.Fprintln(w, "# "+strings.Join(os.Args, " "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "# execution time: %s", ExecutionTime)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "# schedule start time: %s (SOY: %d)", when, (stamp.Unix()-year.Unix())+int64(assist.Leap.Seconds()))
+	fmt.Fprintln(w)
+	// trajectory and time range used to create the schedule (see -verify)
+	if a.Trajectory != "" {
+		fmt.Fprintf(w, "# trajectory: %s", a.Trajectory)
+		fmt.Fprintln(w)
+	}
+	if !a.BaseTime.IsZero() {
+		fmt.Fprintf(w, "# base time: %s", a.BaseTime.Format(time.RFC3339))
+		fmt.Fprintln(w)
+	}
+	if !a.EndTime.IsZero() {
+		fmt.Fprintf(w, "# end time: %s", a.EndTime.Format(time.RFC3339))
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+}
+
+type Provenance struct {
+	File    string     `json:"file"`
+	MD5     string     `json:"md5"`
+	ModTime *time.Time `json:"lastmod,omitempty"`
+	Size    int64      `json:"size"`
+	Inline  bool       `json:"inline,omitempty"`
+}
+
+// Provenance gives the md5, last modification time and size of the trajectory
+// and of the command files used to create the schedule.
+func (a *Assist) Provenance() ([]Provenance, error) {
+	aboutFile := func(file string, digest hash.Hash) (Provenance, error) {
+		defer digest.Reset()
+
+		p := Provenance{File: file}
+		if body, ok := a.inline[file]; ok {
+			io.WriteString(digest, body)
+			p.MD5 = fmt.Sprintf("%x", digest.Sum(nil))
+			p.Size = int64(len(body))
+			p.Inline = true
+			return p, nil
+		}
+		r, err := os.Open(file)
+		if err != nil {
+			return p, assist.CheckError(err, nil)
+		}
+		defer r.Close()
+
+		// the md5 of the command files is computed when they are first read
+		if c, ok := a.commands[file]; ok {
+			p.MD5 = c.MD5
+		} else {
+			if _, err := io.Copy(digest, r); err != nil {
+				return p, assist.CheckError(err, nil)
+			}
+			p.MD5 = fmt.Sprintf("%x", digest.Sum(nil))
+		}
+		s, err := r.Stat()
+		if err != nil {
+			return p, assist.CheckError(err, nil)
+		}
+		mod := s.ModTime()
+		p.ModTime = &mod
+		p.Size = s.Size()
+		return p, nil
+	}
+	var (
+		files  = append([]string{a.Trajectory}, a.commandFiles()...)
+		digest = md5.New()
+		ps     []Provenance
+	)
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		p, err := aboutFile(f, digest)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func (a *Assist) writeMetadata(w io.Writer) ([]Provenance, error) {
+	ps, err := a.Provenance()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ps {
+		if p.Inline {
+			log.Printf("%s: md5 = %s, inline, size: %d bytes", p.File, p.MD5, p.Size)
+			fmt.Fprintf(w, "# %s: md5 = %s, inline, size : %d bytes", p.File, p.MD5, p.Size)
+			fmt.Fprintln(w)
+			continue
+		}
+		modtime := p.ModTime.Format("2006-01-02 15:04:05")
+		log.Printf("%s: md5 = %s, lastmod: %s, size: %d bytes", p.File, p.MD5, modtime, p.Size)
+		fmt.Fprintf(w, "# %s: md5 = %s, lastmod: %s, size : %d bytes", p.File, p.MD5, modtime, p.Size)
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+	return ps, nil
+}
+
+type summary struct {
+	Version   string    `json:"version"`
+	Execution time.Time `json:"execution"`
+	Start     time.Time `json:"start"`
+	Alliop    struct {
+		File string `json:"file"`
+		MD5  string `json:"md5"`
+	} `json:"alliop"`
+	Files     []Provenance             `json:"files"`
+	Scheduled map[string]int           `json:"scheduled"`
+	Dropped   int                      `json:"dropped"`
+	Skipped   map[string]int           `json:"skipped-auroras,omitempty"`
+	Periods   map[string]periodSummary `json:"periods"`
+}
+
+type periodSummary struct {
+	Count    int    `json:"count"`
+	Duration string `json:"duration"`
+}
+
+func (a *Assist) writeSummary(s summary) error {
+	f, err := os.Create(a.Summary)
+	if err != nil {
+		return assist.CheckError(err, nil)
+	}
+	defer f.Close()
+
+	w := json.NewEncoder(f)
+	w.SetIndent("", "  ")
+	return w.Encode(s)
+}
+
+const (
+	InstrMMIA = "MMIA 129"
+	InstrMXGS = "MXGS 128"
+)
+
+// instrCode gives the line written in the instrlist file for an instrument.
+// The codes given in the instruments table take precedence over the default
+// ones and over the instrlist option of the instrument sections.
+func (a *Assist) instrCode(instr string) string {
+	for n, c := range a.Codes {
+		if strings.EqualFold(n, instr) {
+			return c
+		}
+	}
+	switch instr {
+	case assist.InstrROC, assist.InstrACS:
+		return InstrMXGS
+	case assist.InstrCER:
+		return InstrMMIA
+	}
+	for _, i := range a.Instruments {
+		if i.Name == instr {
+			return i.Instr
+		}
+	}
+	return ""
+}
+
+// instrList gives the instrlist lines of the instruments with at least one
+// entry in the schedule.
+func (a *Assist) instrList(ms map[string]coze) []string {
+	var (
+		seen  = make(map[string]struct{})
+		codes []string
+		names = []string{assist.InstrROC, assist.InstrACS, assist.InstrCER}
+	)
+	for _, i := range a.Instruments {
+		names = append(names, i.Name)
+	}
+	for _, n := range names {
+		var used bool
+		for label, c := range ms {
+			if c.Count > 0 && assist.Instrument(label, a.Instruments...) == n {
+				used = true
+				break
+			}
+		}
+		code := a.instrCode(n)
+		if _, ok := seen[code]; !used || ok || code == "" {
+			continue
+		}
+		seen[code] = struct{}{}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// pendingFile is a temporary file created in the directory of the file it
+// replaces once Commit is called. Closing it without committing removes it so
+// that a failed run never leaves a partial output. With backup, the replaced
+// file is kept with a .bak suffix.
+type pendingFile struct {
+	*os.File
+	file   string
+	backup bool
+	done   bool
+}
+
+func createPending(file string, backup bool) (*pendingFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return nil, assist.CheckError(err, nil)
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, assist.CheckError(err, nil)
+	}
+	return &pendingFile{File: f, file: file, backup: backup}, nil
+}
+
+func (p *pendingFile) Commit() error {
+	if err := p.File.Close(); err != nil {
+		return assist.CheckError(err, nil)
+	}
+	p.done = true
+	if p.backup {
+		if i, err := os.Stat(p.file); err == nil && i.Mode().IsRegular() {
+			if err := os.Rename(p.file, p.file+BackupSuffix); err != nil {
+				os.Remove(p.Name())
+				return assist.CheckError(err, nil)
+			}
+			log.Printf("%s: previous version saved as %s", p.file, p.file+BackupSuffix)
+		}
+	}
+	return assist.CheckError(os.Rename(p.Name(), p.file), nil)
+}
+
+func (p *pendingFile) Close() error {
+	if p.done {
+		return nil
+	}
+	p.done = true
+	p.File.Close()
+	return os.Remove(p.Name())
+}
+
+// writePassHeader writes the period (eclipse or aurora) of a block, the SAA
+// crossing it and the commands scheduled in it.
+func (a *Assist) writePassHeader(w io.Writer, p assist.Period, labels []string) {
+	fmt.Fprintf(w, "# %s: %s - %s (%s)", p.Label, p.Starts.Format(timeFormat), p.Ends.Format(timeFormat), p.Duration())
+	fmt.Fprintln(w)
+	for _, s := range a.Saas {
+		if s != p && s.Overlaps(p) {
+			fmt.Fprintf(w, "# saa: %s - %s (crossing: %s)", s.Starts.Format(timeFormat), s.Ends.Format(timeFormat), s.Intersect(p))
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintf(w, "# commands: %s", strings.Join(labels, ", "))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w)
+}
+
+func (a *Assist) writeList(ms map[string]coze) error {
+	if a.Instr == "" {
+		return nil
+	}
+	switch f, err := createPending(a.Instr, a.Backup); {
+	case err == nil:
+		defer f.Close()
+
+		var (
+			digest = md5.New()
+			w      = io.MultiWriter(f, digest)
+		)
+
+		for _, c := range a.instrList(ms) {
+			fmt.Fprintln(w, c)
+		}
+		if err := f.Commit(); err != nil {
+			return err
+		}
+		log.Printf("md5 %s: %x", a.Instr, digest.Sum(nil))
+	default:
+		return err
+	}
+	return nil
+}
+
+func (a *Assist) writeCommands(w io.Writer, file string, cid int, when time.Time, delta time.Duration) (int, time.Duration, error) {
+	if file == "" {
+		return cid, 0, nil
+	}
+	c, err := a.readCommands(file)
+	if err != nil {
+		return cid, 0, err
+	}
+	d := c.Duration
+	if d <= 0 {
+		return cid, 0, nil
+	}
+
+	// the file is streamed again for each entry: only its duration, number of
+	// commands and md5 are kept between the entries
+	r, err := a.openCommands(file)
+	if err != nil {
+		return cid, 0, err
+	}
+	defer r.Close()
+
+	if a.CmdPerBlock {
+		cid = 1
+	}
+	s := a.newScanner(r)
+
+	var elapsed time.Duration
+	if a.KeepComment {
+		end := when.Add(d)
+		fmt.Fprintf(w, "# %s: %s - %s (execution time: %s, %s: %d - %d)", file, when.Format(timeFormat), end.Format(timeFormat), d, a.secondsLabel(), a.seconds(when), a.seconds(end))
+		fmt.Fprintln(w)
+	}
+	var (
+		comment = a.commentPrefix()
+		line    int
+	)
+	for s.Scan() {
+		line++
+		row := s.Text()
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+		if !strings.HasPrefix(row, comment) {
+			if a.Absolute {
+				row = fmt.Sprintf("%d %s", a.seconds(when), row)
+			} else {
+				row = fmt.Sprintf("%d %s", int(delta.Seconds()), row)
+			}
+			delta += assist.Five
+			elapsed += assist.Five
+			when = when.Add(assist.Five)
+		} else {
+			stamp := when //.Truncate(Five)
+			fmt.Fprintf(w, "# %s (GPS): %d/ GMT %03d/%s", a.secondsLabel(), a.seconds(stamp), stamp.YearDay(), stamp.Format("15:04:05"))
+			fmt.Fprintln(w)
+		}
+		isComment := strings.HasPrefix(row, comment)
+		if a.KeepComment && isComment {
+			if a.SourceLines {
+				row = fmt.Sprintf("# CMD %d (src:L%d): %s", cid, line, strings.TrimPrefix(row, comment))
+			} else {
+				row = fmt.Sprintf("# CMD %d: %s", cid, strings.TrimPrefix(row, comment))
+			}
+			cid++
+		}
+		if a.KeepComment || !isComment {
+			fmt.Fprintln(w, row)
+		}
+	}
+	err = scanError(file, s.Err())
+	fmt.Fprintln(w)
+	return cid, elapsed, err
+}
+
+func (a *Assist) seconds(t time.Time) int64 {
+	if a.SecOfDay {
+		return assist.SOD(t)
+	}
+	return assist.SOY(t)
+}
+
+func (a *Assist) secondsLabel() string {
+	if a.SecOfDay {
+		return "SOD"
+	}
+	return "SOY"
+}
+
+func (a *Assist) newScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	if a.MaxLine > bufio.MaxScanTokenSize {
+		s.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), a.MaxLine)
+	}
+	return s
+}
+
+func scanError(file string, err error) error {
+	switch err {
+	case nil:
+		return nil
+	case bufio.ErrTooLong, bufio.ErrNegativeAdvance, bufio.ErrAdvanceTooFar:
+		return assist.BadUsage(fmt.Sprintf("%s: processing failed (%v)", file, err))
+	default:
+		return assist.BadUsage(err.Error())
+	}
+}
+
+// command gives the duration and the number of the commands of a command file
+// and its md5, computed once per run.
+type command struct {
+	Duration time.Duration
+	Lines    int
+	MD5      string
+}
+
+func (a *Assist) loadCommands() error {
+	for _, f := range a.commandFiles() {
+		if f == "" {
+			continue
+		}
+		if _, err := a.readCommands(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Assist) readCommands(file string) (command, error) {
+	if c, ok := a.commands[file]; ok {
+		return c, nil
+	}
+	r, err := a.openCommands(file)
+	if err != nil {
+		return command{}, err
+	}
+	defer r.Close()
+
+	var (
+		c      command
+		digest = md5.New()
+	)
+	c.Duration, c.Lines, err = scheduleDuration(a.newScanner(io.TeeReader(r, digest)), a.commentPrefix())
+	if err != nil {
+		return c, scanError(file, err)
+	}
+	c.MD5 = fmt.Sprintf("%x", digest.Sum(nil))
+	if c.Lines == 0 {
+		log.Printf("warning: %s: no command found (only comments or blank lines), block will be empty", file)
+	}
+	if a.commands == nil {
+		a.commands = make(map[string]command)
+	}
+	a.commands[file] = c
+	return c, nil
+}
+
+func (a *Assist) commentPrefix() string {
+	if a.Comment == "" {
+		return CommentPrefix
+	}
+	return a.Comment
+}
+
+func scheduleDuration(s *bufio.Scanner, comment string) (time.Duration, int, error) {
+	var (
+		d time.Duration
+		n int
+	)
+	for s.Scan() {
+		t := s.Text()
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		if !strings.HasPrefix(t, comment) {
+			d += assist.Five
+			n++
+		}
+	}
+	return d, n, s.Err()
+}
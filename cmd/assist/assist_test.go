@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/busoc/assist"
+)
+
+// setenv sets (or unsets when value is empty) the variable key for the
+// duration of the test.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "assist.toml")
+	if err := os.WriteFile(file, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestOverride(t *testing.T) {
+	data := []struct {
+		Name   string
+		Config string
+		Env    map[string]string
+		Alliop string
+		Instr  string
+		Path   string
+	}{
+		{
+			Name:   "default",
+			Alliop: ALLIOP,
+			Instr:  INSTR,
+		},
+		{
+			Name:   "config",
+			Config: "alliop=\"cfg-alliop.txt\"\ninstrlist=\"cfg-instr.txt\"\npath=\"cfg.csv\"\n",
+			Alliop: "cfg-alliop.txt",
+			Instr:  "cfg-instr.txt",
+			Path:   "cfg.csv",
+		},
+		{
+			Name:   "env-over-config",
+			Config: "alliop=\"cfg-alliop.txt\"\ninstrlist=\"cfg-instr.txt\"\npath=\"cfg.csv\"\n",
+			Env:    map[string]string{EnvAlliop: "env-alliop.txt", EnvPath: "env.csv"},
+			Alliop: "env-alliop.txt",
+			Instr:  "cfg-instr.txt",
+			Path:   "env.csv",
+		},
+		{
+			Name:   "env-over-default",
+			Env:    map[string]string{EnvInstr: "env-instr.txt"},
+			Alliop: ALLIOP,
+			Instr:  "env-instr.txt",
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			for _, k := range []string{EnvAlliop, EnvInstr, EnvPath} {
+				setenv(t, k, d.Env[k])
+			}
+			a := Default()
+			if err := a.Decode(writeConfig(t, d.Config)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if a.Alliop != d.Alliop {
+				t.Errorf("alliop: want %s, got %s", d.Alliop, a.Alliop)
+			}
+			if a.Instr != d.Instr {
+				t.Errorf("instrlist: want %s, got %s", d.Instr, a.Instr)
+			}
+			if a.Trajectory != d.Path {
+				t.Errorf("path: want %s, got %s", d.Path, a.Trajectory)
+			}
+		})
+	}
+}
+
+func TestCheckModes(t *testing.T) {
+	data := []struct {
+		Name   string
+		Config string
+		Fail   bool
+	}{
+		{Name: "default"},
+		{Name: "max-per-day-rule", Config: "[roc]\nmax-per-day-rule=\"longest\"\n"},
+		{Name: "bad-max-per-day-rule", Config: "[roc]\nmax-per-day-rule=\"latest\"\n", Fail: true},
+		{Name: "saa-select", Config: "[roc]\nsaa-select=\"last\"\n[cer]\nsaa-select=\"longest\"\n"},
+		{Name: "bad-roc-saa-select", Config: "[roc]\nsaa-select=\"shortest\"\n", Fail: true},
+		{Name: "bad-cer-saa-select", Config: "[cer]\nsaa-select=\"shortest\"\n", Fail: true},
+		{Name: "algorithm", Config: "[cer]\nalgorithm=\"inside\"\n"},
+		{Name: "bad-algorithm", Config: "[cer]\nalgorithm=\"outside\"\n", Fail: true},
+		{Name: "wait-anchor", Config: "[roc]\nwait-anchor=\"saa\"\n"},
+		{Name: "bad-wait-anchor", Config: "[roc]\nwait-anchor=\"aurora\"\n", Fail: true},
+		{Name: "accept", Config: "[acs]\naccept=\"night-onoff\"\n"},
+		{Name: "bad-accept", Config: "[acs]\naccept=\"day\"\n", Fail: true},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			a := Default()
+			if err := a.Decode(writeConfig(t, d.Config)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			err := a.CheckModes()
+			if d.Fail && err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if !d.Fail && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+// BenchmarkReadCommands scans the command files of a schedule of 500 entries
+// each time an entry is written (scan) or once per file (cached).
+func BenchmarkReadCommands(b *testing.B) {
+	var (
+		dir   = b.TempDir()
+		files []string
+	)
+	for _, n := range []string{"rocon.txt", "rocoff.txt", "ceron.txt", "ceroff.txt"} {
+		var body strings.Builder
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(&body, "# command %d\nCMD_%d ARG1 ARG2\n\n", i, i)
+		}
+		file := filepath.Join(dir, n)
+		if err := os.WriteFile(file, []byte(body.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	const entries = 500
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			a := Default()
+			for j := 0; j < entries; j++ {
+				a.commands = nil
+				if _, err := a.readCommands(files[j%len(files)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			a := Default()
+			for j := 0; j < entries; j++ {
+				if _, err := a.readCommands(files[j%len(files)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestDecodeInstruments(t *testing.T) {
+	data := []struct {
+		Name   string
+		Config string
+		Fail   bool
+	}{
+		{Name: "one", Config: "[[instrument]]\nname=\"LIS\"\n"},
+		{Name: "two", Config: "[[instrument]]\nname=\"LIS\"\n[[instrument]]\nname=\"FLEX\"\n"},
+		{Name: "duplicate", Config: "[[instrument]]\nname=\"LIS\"\n[[instrument]]\nname=\"LIS\"\n", Fail: true},
+		{Name: "builtin", Config: "[[instrument]]\nname=\"roc\"\n", Fail: true},
+		{Name: "unnamed", Config: "[[instrument]]\ninstrlist=\"LIS 130\"\n", Fail: true},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			err := Default().Decode(writeConfig(t, d.Config))
+			if d.Fail && err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if !d.Fail && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestStartOffset(t *testing.T) {
+	const cfg = `[roc]
+on-cmd="CMD ROCON"
+off-cmd="CMD ROCOFF"
+%s
+[cer]
+on-cmd="CMD CERON"
+off-cmd="CMD CEROFF"
+%s
+[[instrument]]
+name="LIS"
+on-cmd="CMD LISON"
+off-cmd="CMD LISOFF"
+%s
+`
+	var (
+		base = time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+		es   = []assist.Entry{
+			{Label: assist.ROCON, When: base.Add(10 * time.Second)},
+			{Label: assist.CERON, When: base.Add(30 * time.Second)},
+			{Label: "LISON", When: base.Add(50 * time.Second)},
+			{Label: "LISOFF", When: base.Add(80 * time.Second)},
+			{Label: assist.CEROFF, When: base.Add(100 * time.Second)},
+			{Label: assist.ROCOFF, When: base.Add(120 * time.Second)},
+		}
+	)
+	data := []struct {
+		Name    string
+		Offsets [3]string
+		Want    map[string]int64
+	}{
+		{
+			Name: "none",
+			Want: map[string]int64{"ROCON": 10, "CERON": 30, "LISON": 50, "LISOFF": 80, "CEROFF": 100, "ROCOFF": 120},
+		},
+		{
+			Name:    "cer",
+			Offsets: [3]string{"", `start-offset="3s"`, ""},
+			Want:    map[string]int64{"ROCON": 10, "CERON": 33, "LISON": 50, "LISOFF": 80, "CEROFF": 103, "ROCOFF": 120},
+		},
+		{
+			Name:    "instrument",
+			Offsets: [3]string{"", "", `start-offset="-5s"`},
+			Want:    map[string]int64{"ROCON": 10, "CERON": 30, "LISON": 45, "LISOFF": 75, "CEROFF": 100, "ROCOFF": 120},
+		},
+		{
+			Name:    "before-start",
+			Offsets: [3]string{`start-offset="-15s"`, "", ""},
+			Want:    map[string]int64{"ROCON": 0, "CERON": 30, "LISON": 50, "LISOFF": 80, "CEROFF": 100, "ROCOFF": 105},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			a := Default()
+			if err := a.Decode(writeConfig(t, fmt.Sprintf(cfg, d.Offsets[0], d.Offsets[1], d.Offsets[2]))); err != nil {
+				t.Fatal(err)
+			}
+			a.KeepComment = false
+
+			var buf bytes.Buffer
+			if _, err := a.writeSchedule(&buf, es, base); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]int64)
+			for _, row := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if row = strings.TrimSpace(row); row == "" {
+					continue
+				}
+				delta, cmd, err := splitCommand(row)
+				if err != nil {
+					t.Fatalf("%s: %s", row, err)
+				}
+				got[strings.TrimPrefix(cmd, "CMD ")] = delta
+			}
+			for label, want := range d.Want {
+				if got[label] != want {
+					t.Errorf("%s: want %d, got %d", label, want, got[label])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownKey(t *testing.T) {
+	data := []struct {
+		Name   string
+		Config string
+		Key    string
+	}{
+		{Name: "top-level", Config: "aliop=\"alliop.txt\"\n", Key: "aliop"},
+		{Name: "roc", Config: "[roc]\nroccon-time=\"60s\"\n", Key: "roccon-time"},
+		{Name: "cer", Config: "[cer]\ncer-min-on=\"60s\"\n", Key: "cer-min-on"},
+		{Name: "acs", Config: "[acs]\nmin-aurora=\"60s\"\n", Key: "min-aurora"},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			err := Default().Decode(writeConfig(t, d.Config))
+			if err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if !strings.Contains(err.Error(), d.Key) {
+				t.Errorf("error should give the key %s: %s", d.Key, err)
+			}
+		})
+	}
+}
+
+// TestDecodeSample checks that the sample configuration shipped in data only
+// uses known keys.
+func TestDecodeSample(t *testing.T) {
+	for _, k := range []string{EnvAlliop, EnvInstr, EnvPath} {
+		setenv(t, k, "")
+	}
+	a := Default()
+	if err := a.Decode(filepath.Join("..", "..", "data", "config.toml")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a.ACS.Night.Duration != 180*time.Second {
+		t.Errorf("min-aurora-duration: want %s, got %s", 180*time.Second, a.ACS.Night.Duration)
+	}
+}
+
+func TestWriteCommandsBlankLines(t *testing.T) {
+	data := []struct {
+		Name string
+		Body string
+	}{
+		{Name: "compact", Body: "# first\nCMD 1\nCMD 2\n# second\nCMD 3\n"},
+		{Name: "blank", Body: "\n# first\n\nCMD 1\n\nCMD 2\n  \n# second\n\t\nCMD 3\n\n\n"},
+		{Name: "no-final-newline", Body: "# first\nCMD 1\nCMD 2\n# second\nCMD 3"},
+	}
+	const want = "# SOY (GPS): 2073618/ GMT 025/00:00:00\n0 CMD 1\n5 CMD 2\n# SOY (GPS): 2073628/ GMT 025/00:00:10\n10 CMD 3\n\n"
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "commands.txt")
+			if err := os.WriteFile(file, []byte(d.Body), 0644); err != nil {
+				t.Fatal(err)
+			}
+			a := Default()
+			a.KeepComment = false
+
+			c, err := a.readCommands(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Lines != 3 || c.Duration != 3*assist.Five {
+				t.Errorf("want 3 commands (%s), got %d (%s)", 3*assist.Five, c.Lines, c.Duration)
+			}
+			if sum := fmt.Sprintf("%x", md5.Sum([]byte(d.Body))); c.MD5 != sum {
+				t.Errorf("md5: want %s, got %s", sum, c.MD5)
+			}
+			var (
+				buf  bytes.Buffer
+				when = time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+			)
+			_, elapsed, err := a.writeCommands(&buf, file, 1, when, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed != c.Duration {
+				t.Errorf("elapsed: want %s, got %s", c.Duration, elapsed)
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestRejectEmpty(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		a := Default()
+		a.Trajectory = filepath.Join("..", "..", "testdata", "saa-blip.csv")
+		a.RejectEmpty = reject
+		err := a.Open()
+		if reject && err == nil {
+			t.Errorf("reject-empty: expected error but got none")
+		}
+		if !reject && err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestGapBuckets(t *testing.T) {
+	var (
+		base = time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+		a    = Default()
+		es   = []assist.Entry{
+			{Label: assist.CERON, When: base},
+			{Label: assist.ROCON, When: base.Add(100 * time.Second)},
+			{Label: assist.ROCOFF, When: base.Add(700 * time.Second)},
+			{Label: assist.CEROFF, When: base.Add(800 * time.Second)},
+			{Label: assist.ROCON, When: base.Add(900 * time.Second)},
+			{Label: assist.ROCOFF, When: base.Add(1000 * time.Second)},
+			{Label: assist.CERON, When: base.Add(1100 * time.Second)},
+			{Label: assist.CEROFF, When: base.Add(1200 * time.Second)},
+		}
+	)
+	a.CER.TimeOn = assist.NewDuration(600)
+	a.ROC.TimeOn = assist.NewDuration(40)
+	a.ROC.TimeOff = assist.NewDuration(80)
+
+	// the first ROC block runs inside the first CER block: the gap before the
+	// second ROC block starts at the end of CEROFF, not at the end of ROCOFF
+	counts, buckets := a.gapBuckets(es, time.Minute)
+	if want := []int{-1, 0, 1}; fmt.Sprint(buckets) != fmt.Sprint(want) {
+		t.Fatalf("buckets: want %v, got %v", want, buckets)
+	}
+	for _, j := range buckets {
+		if counts[j] != 1 {
+			t.Errorf("bucket %d: want 1 gap, got %d", j, counts[j])
+		}
+	}
+}
+
+func TestSelectedInstrument(t *testing.T) {
+	data := []struct {
+		Only []string
+		Want map[string]bool
+	}{
+		{Want: map[string]bool{assist.InstrROC: true, assist.InstrCER: true, assist.InstrACS: true, "LIS": true}},
+		{Only: []string{assist.ROCOFF}, Want: map[string]bool{assist.InstrROC: true}},
+		{Only: []string{assist.CERON, "LISOFF"}, Want: map[string]bool{assist.InstrCER: true, "LIS": true}},
+	}
+	for _, d := range data {
+		t.Run(strings.Join(d.Only, ","), func(t *testing.T) {
+			a := Default()
+			a.Instruments = []assist.InstrumentOption{{Name: "LIS"}}
+			a.Only = d.Only
+			for _, instr := range []string{assist.InstrROC, assist.InstrCER, assist.InstrACS, "LIS"} {
+				if got := a.selectedInstrument(instr); got != d.Want[instr] {
+					t.Errorf("%s: want %t, got %t", instr, d.Want[instr], got)
+				}
+			}
+		})
+	}
+}
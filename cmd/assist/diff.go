@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/busoc/assist"
+)
+
+type alliopCommand struct {
+	SOY  int64
+	Cmd  string
+	Line int
+}
+
+type alliopFile struct {
+	File string
+	MD5  string
+}
+
+type alliop struct {
+	Start    int64
+	When     time.Time
+	Files    []alliopFile
+	Commands []alliopCommand
+
+	// Trajectory, Base and End are the trajectory and the time range given
+	// to create the schedule. They are empty in alliop files created before
+	// they were written in the metadata.
+	Trajectory string
+	Base       time.Time
+	End        time.Time
+}
+
+// alliopTime is the format of the schedule start time in the metadata.
+const alliopTime = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func readAlliop(file string) (alliop, error) {
+	var a alliop
+	r, err := os.Open(file)
+	if err != nil {
+		return a, assist.CheckError(err, nil)
+	}
+	defer r.Close()
+
+	var (
+		start int64 = -1
+		s           = bufio.NewScanner(r)
+	)
+	s.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MaxLineSize)
+	for n := 1; s.Scan(); n++ {
+		row := strings.TrimSpace(s.Text())
+		if row == "" {
+			continue
+		}
+		if strings.HasPrefix(row, "#") {
+			ix := strings.LastIndex(row, "(SOY: ")
+			if start < 0 && strings.HasPrefix(row, "# schedule start time:") && ix >= 0 {
+				soy := strings.TrimSuffix(row[ix+6:], ")")
+				if start, err = strconv.ParseInt(soy, 10, 64); err != nil {
+					return a, assist.BadUsage(fmt.Sprintf("%s:%d: invalid schedule start time", file, n))
+				}
+				str := strings.TrimSpace(row[len("# schedule start time:"):ix])
+				if a.When, err = time.Parse(alliopTime, str); err != nil {
+					return a, assist.BadUsage(fmt.Sprintf("%s:%d: invalid schedule start time", file, n))
+				}
+				continue
+			}
+			if str := strings.TrimPrefix(row, "# trajectory:"); str != row && len(a.Commands) == 0 {
+				a.Trajectory = strings.TrimSpace(str)
+				continue
+			}
+			if str := strings.TrimPrefix(row, "# base time:"); str != row && len(a.Commands) == 0 {
+				if a.Base, err = time.Parse(time.RFC3339, strings.TrimSpace(str)); err != nil {
+					return a, assist.BadUsage(fmt.Sprintf("%s:%d: invalid base time", file, n))
+				}
+				continue
+			}
+			if str := strings.TrimPrefix(row, "# end time:"); str != row && len(a.Commands) == 0 {
+				if a.End, err = time.Parse(time.RFC3339, strings.TrimSpace(str)); err != nil {
+					return a, assist.BadUsage(fmt.Sprintf("%s:%d: invalid end time", file, n))
+				}
+				continue
+			}
+			if ix := strings.Index(row, ": md5 = "); ix >= 0 && len(a.Commands) == 0 {
+				sum := row[ix+8:]
+				if ix := strings.Index(sum, ","); ix >= 0 {
+					sum = sum[:ix]
+				}
+				a.Files = append(a.Files, alliopFile{
+					File: strings.TrimSpace(row[1:ix]),
+					MD5:  sum,
+				})
+			}
+			continue
+		}
+		if start < 0 {
+			return a, assist.BadUsage(fmt.Sprintf("%s: schedule start time not found", file))
+		}
+		delta, cmd, err := splitCommand(row)
+		if err != nil {
+			return a, assist.BadUsage(fmt.Sprintf("%s:%d: %s", file, n, err))
+		}
+		a.Commands = append(a.Commands, alliopCommand{
+			SOY:  start + delta,
+			Cmd:  cmd,
+			Line: n,
+		})
+	}
+	if err := s.Err(); err != nil {
+		return a, assist.BadUsage(fmt.Sprintf("%s: processing failed (%v)", file, err))
+	}
+	a.Start = start
+	return a, nil
+}
+
+// splitCommand splits a command row of an alliop file into its delta from the
+// schedule start time and its command.
+func splitCommand(row string) (int64, string, error) {
+	ix := strings.IndexAny(row, " \t")
+	if ix < 0 {
+		return 0, "", fmt.Errorf("invalid command")
+	}
+	delta, err := strconv.ParseInt(row[:ix], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid command delta")
+	}
+	return delta, strings.TrimSpace(row[ix:]), nil
+}
+
+// DiffAlliop compares the commands of two alliop files. Commands are matched
+// on their text and on their time: a command of the second file matches the
+// closest unmatched command with the same text of the first file if the time
+// between both is less than or equal to tolerance.
+func DiffAlliop(prev, next string, tolerance time.Duration) error {
+	pa, err := readAlliop(prev)
+	if err != nil {
+		return err
+	}
+	na, err := readAlliop(next)
+	if err != nil {
+		return err
+	}
+	var (
+		olds    = pa.Commands
+		news    = na.Commands
+		limit   = int64(tolerance.Seconds())
+		matched = make([]bool, len(olds))
+		groups  = make(map[string][]int)
+		added   []alliopCommand
+		shifted [][2]alliopCommand
+		same    int
+	)
+	for i, c := range olds {
+		groups[c.Cmd] = append(groups[c.Cmd], i)
+	}
+	for _, c := range news {
+		j := -1
+		for _, i := range groups[c.Cmd] {
+			if matched[i] {
+				continue
+			}
+			d := abs(olds[i].SOY - c.SOY)
+			if d > limit {
+				continue
+			}
+			if j < 0 || d < abs(olds[j].SOY-c.SOY) {
+				j = i
+			}
+		}
+		if j < 0 {
+			added = append(added, c)
+			continue
+		}
+		matched[j] = true
+		if olds[j].SOY == c.SOY {
+			same++
+		} else {
+			shifted = append(shifted, [2]alliopCommand{olds[j], c})
+		}
+	}
+	var removed []alliopCommand
+	for i, c := range olds {
+		if !matched[i] {
+			removed = append(removed, c)
+		}
+	}
+	type change struct {
+		SOY  int64
+		Line string
+	}
+	var cs []change
+	for _, c := range removed {
+		cs = append(cs, change{SOY: c.SOY, Line: fmt.Sprintf("- %d | %s", c.SOY, c.Cmd)})
+	}
+	for _, c := range added {
+		cs = append(cs, change{SOY: c.SOY, Line: fmt.Sprintf("+ %d | %s", c.SOY, c.Cmd)})
+	}
+	for _, c := range shifted {
+		cs = append(cs, change{SOY: c[1].SOY, Line: fmt.Sprintf("~ %d | %s (was: %d, %+ds)", c[1].SOY, c[1].Cmd, c[0].SOY, c[1].SOY-c[0].SOY)})
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].SOY < cs[j].SOY })
+	for _, c := range cs {
+		fmt.Println(c.Line)
+	}
+	fmt.Printf("unchanged: %d, shifted: %d, added: %d, removed: %d", same, len(shifted), len(added), len(removed))
+	fmt.Println()
+	return nil
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
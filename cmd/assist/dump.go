@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/busoc/assist"
+)
+
+// DumpConfig writes the effective configuration (defaults, configuration file
+// and flags merged) as TOML that can be given back to assist.
+func (a *Assist) DumpConfig(w io.Writer) error {
+	return dumpTable(w, "", reflect.ValueOf(a).Elem())
+}
+
+type tomlField struct {
+	Key   string
+	Value reflect.Value
+}
+
+func tomlFields(v reflect.Value) []tomlField {
+	var (
+		typ = v.Type()
+		fs  []tomlField
+	)
+	for i := 0; i < v.NumField(); i++ {
+		var (
+			tf  = typ.Field(i)
+			f   = v.Field(i)
+			tag = tf.Tag.Get("toml")
+		)
+		if tf.PkgPath != "" || tag == "-" {
+			continue
+		}
+		if tf.Anonymous && tag == "" {
+			fs = append(fs, tomlFields(f)...)
+			continue
+		}
+		if tag == "" {
+			tag = strings.ToLower(tf.Name)
+		}
+		fs = append(fs, tomlField{Key: tag, Value: f})
+	}
+	return fs
+}
+
+var (
+	durationType = reflect.TypeOf(assist.Duration{})
+	timeType     = reflect.TypeOf(time.Time{})
+	filesetType  = reflect.TypeOf(assist.Fileset{})
+)
+
+func isTable(v reflect.Value) bool {
+	if v.Kind() == reflect.Map {
+		return v.Len() > 0
+	}
+	return v.Kind() == reflect.Struct && v.Type() != durationType && v.Type() != timeType
+}
+
+func isArrayTable(v reflect.Value) bool {
+	if v.Kind() != reflect.Slice {
+		return false
+	}
+	e := v.Type().Elem()
+	return e.Kind() == reflect.Struct && e != timeType && e != durationType && e != reflect.TypeOf(assist.Rect{}) && e != reflect.TypeOf(assist.Period{})
+}
+
+func dumpTable(w io.Writer, name string, v reflect.Value) error {
+	if v.Kind() == reflect.Map {
+		return dumpMap(w, v)
+	}
+	var tables, arrays []tomlField
+	for _, f := range tomlFields(v) {
+		switch {
+		case isTable(f.Value):
+			tables = append(tables, f)
+		case isArrayTable(f.Value):
+			arrays = append(arrays, f)
+		default:
+			if err := dumpOption(w, f.Key, f.Value, v); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range tables {
+		key := t.Key
+		if name != "" {
+			key = name + "." + key
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "[%s]", key)
+		fmt.Fprintln(w)
+		if err := dumpTable(w, key, t.Value); err != nil {
+			return err
+		}
+	}
+	for _, t := range arrays {
+		for i := 0; i < t.Value.Len(); i++ {
+			fmt.Fprintln(w)
+			fmt.Fprintf(w, "[[%s]]", t.Key)
+			fmt.Fprintln(w)
+			if err := dumpTable(w, t.Key, t.Value.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func dumpMap(w io.Writer, v reflect.Value) error {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, k := range keys {
+		str, err := tomlValue(v.MapIndex(k))
+		if err != nil {
+			return fmt.Errorf("%s: %v", k.String(), err)
+		}
+		fmt.Fprintf(w, "%s = %s", tomlString(k.String()), str)
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func dumpOption(w io.Writer, key string, v, parent reflect.Value) error {
+	// the name given to inline commands can not be given back with them
+	if f := parent.FieldByName("Fileset"); f.IsValid() && f.Type() == filesetType {
+		fs := f.Interface().(assist.Fileset)
+		if (key == "on-cmd-file" && fs.OnCmd != "") || (key == "off-cmd-file" && fs.OffCmd != "") {
+			return nil
+		}
+	}
+	if isZeroOption(v) {
+		return nil
+	}
+	str, err := tomlValue(v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	fmt.Fprintf(w, "%s = %s", key, str)
+	fmt.Fprintln(w)
+	return nil
+}
+
+func isZeroOption(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+func tomlValue(v reflect.Value) (string, error) {
+	switch {
+	case v.Type() == durationType:
+		return tomlString(v.Interface().(assist.Duration).Duration.String()), nil
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return tomlString(v.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		var xs []string
+		for i := 0; i < v.Len(); i++ {
+			x, err := tomlValue(v.Index(i))
+			if err != nil {
+				return "", err
+			}
+			xs = append(xs, x)
+		}
+		return "[" + strings.Join(xs, ", ") + "]", nil
+	case reflect.Struct:
+		var xs []string
+		for _, f := range tomlFields(v) {
+			if isZeroOption(f.Value) {
+				continue
+			}
+			x, err := tomlValue(f.Value)
+			if err != nil {
+				return "", err
+			}
+			xs = append(xs, f.Key+" = "+x)
+		}
+		return "{" + strings.Join(xs, ", ") + "}", nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
+
+func tomlString(str string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range str {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
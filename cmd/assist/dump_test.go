@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDumpConfig(t *testing.T) {
+	const cfg = `alliop="alliop.txt"
+instrlist="instrlist.txt"
+path="trajectory.csv"
+resolution="10s"
+min-gap="30s"
+conflict="shift"
+rounding="round"
+base-time=2021-01-25T10:00:00Z
+end-time=2021-01-26T10:00:00Z
+
+[roc]
+on-cmd="CMD ROCON"
+off-cmd="CMD ROCOFF"
+azm-enter="30s"
+wait-anchor="saa"
+max-per-day=4
+
+[cer]
+on-cmd-file="ceron.txt"
+off-cmd-file="ceroff.txt"
+algorithm="classic"
+saa-crossing-time="0s"
+
+[acs]
+on-cmd="CMD ACSON\nCMD ACSON2"
+off-cmd="CMD ACSOFF"
+min-aurora-duration="300s"
+areas=[{name="north",north=90,south=45,west=-180,east=180,duration="20s"}]
+
+[[instrument]]
+name="LIS"
+instrlist="LIS 130"
+on-cmd="CMD LISON"
+off-cmd="CMD LISOFF"
+
+[instruments]
+cer="MMIA 129"
+`
+	for _, k := range []string{EnvAlliop, EnvInstr, EnvPath} {
+		setenv(t, k, "")
+	}
+	want := Default()
+	if err := want.Decode(writeConfig(t, cfg)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := want.DumpConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := Default()
+	if err := got.Decode(writeConfig(t, buf.String())); err != nil {
+		t.Fatalf("dumped configuration can not be decoded: %s\n%s", err, buf.String())
+	}
+	for _, ts := range [][2]*time.Time{{&want.BaseTime, &got.BaseTime}, {&want.EndTime, &got.EndTime}} {
+		if !ts[0].Equal(*ts[1]) {
+			t.Errorf("time range: want %s, got %s", ts[0], ts[1])
+		}
+		// the location of the decoded times can differ
+		*ts[0], *ts[1] = time.Time{}, time.Time{}
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("dumped configuration differs\n--- want\n%+v\n--- got\n%+v\n--- dump\n%s", want, got, buf.String())
+	}
+}
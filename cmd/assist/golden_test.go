@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// volatile matches the parts of an alliop changing from one run (or one
+// checkout) to another.
+var volatile = regexp.MustCompile(`(?m)^# (assist-|execution time:).*\n|lastmod: [^,]+`)
+
+func TestGolden(t *testing.T) {
+	const acs = `[acs]
+on-cmd="CMD ACSON"
+off-cmd="CMD ACSOFF"
+min-aurora-duration="300s"
+duration="20s"
+areas=[{north=90,south=45,west=-180,east=180}]`
+
+	base := time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"one-eclipse", "eclipse-saa", "eclipse-two-saa", "aurora"} {
+		t.Run(name, func(t *testing.T) {
+			a := createAlliop(t, name+".csv", base, acs)
+			for _, f := range []struct {
+				File string
+				Ext  string
+			}{
+				{File: a.Alliop, Ext: ".alliop"},
+				{File: a.Instr, Ext: ".instrlist"},
+			} {
+				got, err := os.ReadFile(f.File)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = volatile.ReplaceAllFunc(got, func(b []byte) []byte {
+					if b[0] == '#' {
+						return nil
+					}
+					return []byte("lastmod: -")
+				})
+
+				golden := filepath.Join("..", "..", "testdata", "golden", name+f.Ext)
+				if *update {
+					if err := os.WriteFile(golden, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("%s: output differs from golden file\n--- want\n%s\n--- got\n%s", golden, want, strings.TrimSpace(string(got)))
+				}
+			}
+		})
+	}
+}
+
+// TestPassHeaderClassic checks that the CERON of the classic algorithm, not
+// belonging to any pass, does not get a pass header.
+func TestPassHeaderClassic(t *testing.T) {
+	var (
+		base = time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+		a    = configAlliop(t, "eclipse-saa.csv", `algorithm="classic"`)
+	)
+	a.PassHeader = true
+	if err := a.OpenAndFilter(base); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Create(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(a.Alliop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []string
+	for _, row := range strings.Split(string(got), "\n") {
+		if strings.HasPrefix(row, "# commands: ") {
+			headers = append(headers, strings.TrimPrefix(row, "# commands: "))
+		}
+	}
+	if len(headers) != 1 || headers[0] != "ROCON, ROCOFF" {
+		t.Errorf("want one pass with ROCON, ROCOFF, got %q", headers)
+	}
+	if strings.Contains(string(got), "0001-01-01") || strings.Contains(string(got), "# : ") {
+		t.Errorf("pass header written for an entry without period\n%s", got)
+	}
+	if !strings.Contains(string(got), "CMD CERON") {
+		t.Errorf("CERON not scheduled\n%s", got)
+	}
+}
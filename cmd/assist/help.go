@@ -0,0 +1,266 @@
+package main
+
+const helpText = `ASIM Semi Automatic Schedule Tool
+
+Usage: assist [options] <config.toml>
+       assist -diff [-diff-tolerance <duration>] <prev-alliop> <next-alliop>
+       assist -verify <alliop> <config.toml>
+
+when <config.toml> is -, the configuration is read from stdin. The trajectory can
+then not be read from stdin and should be given with path (or ASSIST_PATH).
+
+Command files:
+
+assist accepts command files by pair. In other words, if the ROCON file is given,
+the ROCOFF should also be provided. The same is true for the CERON/CEROFF files.
+
+However, it is not mandatory to have the 4 files provided. A schedule can be
+created only for ROC or for CER (see examples below).
+
+It is an error to not provide any file unless if the list flag is given to assist.
+
+Input format:
+
+the input of assist consists of a tabulated "file". The columns of the file are:
+
+- datetime (YYYY-mm-dd HH:MM:SS.ssssss)
+- modified julian day
+- altitude (kilometer)
+- latitude (degree or DMS)
+- longitude (degree or DMS)
+- eclipse (1: night, 0: day)
+- crossing (1: in SAA, 0: out of SAA)
+- TLE epoch
+
+assist only uses the columns from the input file (but all are mandatory even if
+empty):
+
+- datetime (column 1)
+- latitude and longitude (columns 4 and 5, for the ACS areas)
+- eclipse (column 6 by default): the ISS is in the night side of the Earth
+- crossing (column 7 by default): the ISS is crossing the SAA
+
+the position of the eclipse and crossing columns can be changed with the columns
+section of the configuration (eg: for files where both columns are swapped).
+
+the values accepted by assist to decide if the trajectory is "entering" SAA/
+Eclipse, are: 1, on, true
+
+the values accepted by assist to decide if the trajectory is "leaving" SAA/
+Eclipse are: 0, off, false
+
+Configuration sections/options:
+
+There are three main sections in the configuration files (options for each section
+are described below - check also the Options section of this help for additional
+information). Unknown options and sections are always rejected by assist with an
+error giving the offending key (eg: "roccon-time: invalid option"):
+
+* default : configuring the input and output of assist
+  - alliop       = file where schedule file will be created
+  - instrlist    = file where instrlist file will be created
+  - path         = file with the input trajectory to use to create the schedule
+	- resolution   = time interval between two rows in the trajectory file
+  - keep-comment = schedule contains the comment present in the command files
+  - cmd-per-block = restart the numbering of the "# CMD N" comments in each block
+  - no-args-comment = do not write the command line of assist in the schedule (or -no-args-comment)
+  - comment      = prefix of the comment lines in the command files (default: #)
+  - ignore       = keep entries from blocks that do not meet constraints
+  - min-gap      = minimum interval of time between the end of a block and the next one.
+                   Blocks too close are flagged (min-gap). With ignore, a flagged block is
+                   also moved after the gap when it still ends within its period
+  - conflict     = ROC margin conflict resolution: drop, ignore or shift
+  - workers      = number of workers used to schedule ROC blocks concurrently
+  - max-line     = maximum length (in bytes) of a line in the command files
+  - start-delay  = warn when the first command is scheduled later than this after base-time
+  - start-padding = time between the schedule start and its first command (default: 5s)
+  - rounding     = rounding of the command times to the second before they are written:
+                   truncate, round or ceil (default: times are written as computed)
+  - blackouts    = array of windows (starts, ends) where no command can be scheduled
+  - base-time    = schedule start time (replaced by -base-time when given)
+  - end-time     = schedule end time (replaced by -end-time when given)
+
+* roc: configuring the ROC commands (MXGS)
+  - on-cmd-file        = file with the commands of ROCON in text format
+  - off-cmd-file       = file with the commands of ROCOFF in text format
+  - wait-before-on     = wait time after entering eclipse for ROCON to be scheduled
+  - wait-anchor        = start of the wait before ROCON: eclipse (default) or saa when a
+                         SAA crosses the eclipse
+  - azm-duration       = duration of the AZM
+  - azm-enter          = duration of the AZM when entering the SAA (default: azm-duration)
+  - azm-exit           = duration of the AZM when leaving the SAA (default: azm-duration)
+  - on-duration        = expected time of the ROCON
+  - off-duration       = expected time of the ROCOFF
+  - time-between-onoff = minium interval of time between ROCON end and ROCOFF start
+  - saa-duration       = mininum SAA duration to have an AZM scheduled
+  - saa-select         = SAA driving the AZM placement when several cross an eclipse:
+                         first, last or longest (default: first for ROCON, last for ROCOFF)
+  - max-per-day        = maximum number of ROC blocks per UTC day (0: no limit)
+  - max-per-day-rule   = blocks kept when the limit is reached: earliest (default) or longest eclipse
+  - max-per-day-window = length of the window used instead of the UTC day (eg: orbit period).
+                         The windows start at -orbit-epoch when -orbit-period is set, at base-time
+                         otherwise
+  - in-daylight        = schedule ROC in the daylight between two eclipses instead of the eclipses
+  - start-offset       = shift applied to the ROC commands when written in the schedule
+
+* cer: configuring the CER commands (MMIA)
+  - on-cmd-file       = file with the commands of CERON in text format
+  - off-cmd-file      = file with the commands of CEROFF in text format
+  - on-duration       = expected time of the CERON
+  - off-duration      = expected time of the CEROFF
+  - switch-onoff-time = selects the classic CER algorithm when not zero. Its value is not
+                        used to place CER(ON|OFF)
+  - time-before-saa   = time before SAA during eclipse to schedule CERON
+  - time-after-saa    = time after SAA during eclipse to schedule CEROFF
+  - time-before-roc   = time before ROCON/ROCOFF to schedule a CERON
+  - time-after-roc    = time after ROCON/ROCOFF to schedule a CEROFF
+  - saa-crossing-time = mininum time of SAA and Eclipse
+  - saa-select        = SAA driving the CER placement when several cross an eclipse:
+                        first, last or longest (default: the span of all of them)
+  - saa-merge-gap     = SAA separated by less than this gap are merged before scheduling CER
+                        (overlapping SAA are always merged)
+  - min-on-duration   = minimum time between CERON and CEROFF for a pair to be kept
+  - start-offset      = shift applied to the CER commands when written in the schedule
+  - algorithm         = CER scheduling algorithm (or -cer-algo): classic, inside or saa
+
+  - classic: CER(ON|OFF) are switched before entering eclipse. An eclipse crosses the SAA
+             when it overlaps a SAA for more than saa-crossing-time. When
+             saa-crossing-time is 0, every eclipse is taken as crossing as soon as the
+             trajectory has a SAA, overlapping it or not. CERON is scheduled on-duration
+             before the first crossing eclipse that follows a non crossing one, CEROFF
+             off-duration before the first non crossing eclipse that follows a crossing
+             one. The first eclipse of the schedule always gets a CERON or a CEROFF.
+  - inside : CER(ON|OFF) are scheduled around the SAA crossing during eclipse. It uses
+             time-before-saa, time-after-saa, time-before-roc, time-after-roc and
+             saa-crossing-time.
+  - saa    : CERON is scheduled time-before-saa before entering each SAA and CEROFF
+             time-after-saa after leaving it, whether the SAA crosses an eclipse or not.
+             CER stays on between two SAA too close to be switched off and on. It does
+             not need ROC.
+  when not set, classic is used if switch-onoff-time is not zero, inside otherwise.
+
+* acs: configuring the ACS commands (MXGS) for automatic auroral captures
+  - on-cmd-file         = file with the commands of ACSON in text format
+  - off-cmd-file        = file with the commands of ACSOFF in text format
+  - duration            = ACS expected execution time of ACSON and of ACSOFF
+  - min-aurora-duration = ACS minimum night duration
+  - areas               = array of rectangle that defined the north, east, south and west
+                          boundaries of a box and optionally its name. The aurora periods
+                          found in a named box carry its name (listed with -list-periods,
+                          -list-entries and -inspect) and a new aurora period starts when the
+                          ISS moves from one named box to another. A named box can also
+                          override duration and min-aurora-duration for the aurora periods
+                          found in it
+  - force-off           = schedule ACSOFF even when the ACSON of the same period has been
+                          suppressed
+  - accept              = rule deciding which aurora periods get ACS commands: night (default)
+                          when the period is at least min-aurora-duration long, night-onoff
+                          when it is at least min-aurora-duration plus the duration of ACSON
+                          and ACSOFF
+  - without-roc         = schedule ACS when no ROC is scheduled (or -acs-without-roc): ACSON
+                          at the start of the aurora and ACSOFF before its end
+  - start-offset        = shift applied to the ACS commands when written in the schedule
+
+  the commands can also be given inline in the roc, cer, acs and instrument sections
+  with the on-cmd and off-cmd options (multiline strings) instead of on-cmd-file and
+  off-cmd-file. The md5 of the inline commands is written in the schedule metadata.
+
+* instrument: array of additional instruments, each one scheduled with the ROC rules
+  and its own options (<name>ON/<name>OFF)
+  - name      = name of the instrument, unique (ROC, CER and ACS are reserved)
+  - instrlist = line added to the instrlist file when the instrument is scheduled
+  it accepts the same options as the roc section (durations, AZM and command files).
+  ROC, CER and ACS are not part of this array: they keep their own sections and rules
+
+* instruments: line written in the instrlist file for each instrument (roc, cer, acs or
+  the name of an instrument section) having at least one command in the schedule.
+  default: roc and acs = MXGS 128, cer = MMIA 129, others = their instrlist option
+  instruments sharing a line (eg: roc and acs) are written once. Give acs its own line
+  to have it in the instrlist only when ACS is scheduled, independently of ROC
+
+* columns: position (starting at 1) of the columns of the trajectory used by assist
+  - eclipse = column giving the eclipse periods (default: 6)
+  - saa     = column giving the SAA crossing periods (default: 7)
+  both columns should be different and can not be the datetime, latitude or longitude
+
+Environment:
+
+the following variables, when set, override the files given in the configuration:
+
+  ASSIST_ALLIOP    = file where schedule file will be created (alliop)
+  ASSIST_INSTRLIST = file where instrlist file will be created (instrlist)
+  ASSIST_PATH      = file with the input trajectory (path)
+
+these files can not be given with a flag: the precedence is environment >
+configuration > default
+
+Options:
+
+  -end-time      drop periods starting after this time and truncate the ones crossing it
+  -list-periods  print the list of eclipses and crossing periods after base-time
+  -all-periods   list-periods prints every period of the trajectory, including the ones
+                 before base-time and after end-time
+  -list-entries  print the list of commands instead of creating a schedule
+  -conflicts-only print only the entries in conflict, with the reason and the block
+                 they belong to, and their count
+  -only          list-entries only prints the entries with the given labels (comma
+                 separated, eg: CERON,CEROFF). The totals, daily usage, concurrency and
+                 gaps only use these entries, the dropped blocks and skipped auroras are
+                 the ones of their instruments
+  -no-color      do not print the entries in conflict in red when the output of
+                 list-entries is a terminal (same as setting NO_COLOR)
+  -format        output format of list-entries (text, json, ics)
+  -precise       print times with microseconds in list-periods and list-entries
+  -absolute-times prefix the commands in the schedule with their SOY (or SOD with -sod)
+                 instead of the delta from the schedule start time. Schedules created
+                 with this option can not be given to -diff and -verify
+  -sod           print the seconds of day (SOD) instead of the seconds of year (SOY) in
+                 list-entries and in the comments of the schedule
+  -timeline      print a timeline of the periods and of the instruments switched on
+  -timeline-step time covered by each column of the timeline (default: 1m)
+  -orbit-period  orbital period used to annotate the listings with orbit numbers
+  -orbit-epoch   start time of the reference orbit (default: base-time)
+  -acs-area      add an ACS area given as [NAME:]N,S,W,E (can be repeated)
+  -ignore        keep entries from blocks that do not meet constraints
+  -cer-algo      force the CER scheduling algorithm (classic, inside, saa)
+  -acs-without-roc schedule ACS when no ROC is scheduled
+  -conflict      resolve ROC margin conflicts by dropping, ignoring or shifting the block
+  -min-gap       minimum interval of time between two consecutive blocks
+  -check         check the configuration and the files it refers to and exit
+  -trace         log each rule moving a command (AZM, SAA anchor, ROC margin, CER or ACS
+                 around ROC) with the time of the command before and after the rule
+  -strict        fail instead of warning when the most frequent interval between the rows
+                 of the trajectory differs from the resolution by more than 10%
+  -reject-empty-periods fail when the trajectory has periods of zero duration (a flag set
+                 on a single row) instead of removing them
+  -validate      check that the periods of the trajectory are consistent (sorted, eclipses
+                 not overlapping, auroras inside eclipses, no zero duration) before scheduling
+  -dump-config   print the configuration (defaults, configuration file and flags merged)
+                 as TOML, including base-time and end-time, and exit
+  -inspect       print the eclipse at the given time (RFC3339), the SAA and auroras crossing
+                 it, the AZM windows used to move ROCON and ROCOFF and the commands
+                 scheduled for this eclipse alone
+  -verify        schedule again the trajectory and the time range written in the metadata
+                 of an alliop file with the configuration and report the commands of each
+                 label missing from it or not expected in it
+  -diff          compare the commands of two alliop files given as arguments and exit
+  -diff-tolerance maximum shift of a command to be matched between two alliop files
+  -workers       number of workers used to schedule ROC blocks concurrently
+  -progress      report progress while reading the trajectory
+  -fail-empty    exit with an error when no command is scheduled and keep the previous
+                 schedule (otherwise an alliop without commands and an empty instrlist
+                 replace it)
+  -source-lines  add the line number in the command file to the kept comments
+                 (# CMD N (src:L12): ...)
+  -no-args-comment do not write the command line of assist in the schedule
+  -pass-header   write a comment with the eclipse (or aurora), the SAA crossing it and the
+                 commands scheduled in it before the commands of each pass
+  -backup        keep the alliop and instrlist files being replaced with a .bak suffix
+  -summary       write a JSON summary of the schedule with the md5, size and last
+                 modification time of the trajectory and of the command files, and
+                 the number of auroras skipped by ACS by reason
+  -source-date   execution time written in the schedule instead of the current time, as a
+                 unix timestamp or in RFC3339 format (default: $SOURCE_DATE_EPOCH). The
+                 default base-time is computed from it
+  -version       print assist version and exit
+  -help          print this message and exit`
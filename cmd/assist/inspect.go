@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/busoc/assist"
+)
+
+// Inspect prints how the commands of the eclipse containing t are scheduled:
+// the periods crossing the eclipse, the AZM windows of the SAA selected for
+// ROCON and ROCOFF and the entries scheduled for the eclipse alone.
+func (a *Assist) Inspect(t time.Time) error {
+	timefmt := a.listFormat()
+	i, err := a.Schedule.Inspect(t, a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+	printPeriod := func(p assist.Period, extra string) {
+		fmt.Printf("%-8s | %s | %s | %s%s", p.Label, p.Starts.Format(timefmt), p.Ends.Format(timefmt), p.Duration(), extra)
+		fmt.Println()
+	}
+	printPeriod(i.Eclipse, "")
+	for _, s := range i.Saas {
+		printPeriod(s, fmt.Sprintf(" (crossing: %s)", s.Intersect(i.Eclipse)))
+	}
+	for _, x := range i.Auroras {
+		var area string
+		if x.Area != "" {
+			area = fmt.Sprintf(" (area: %s)", x.Area)
+		}
+		printPeriod(x, area)
+	}
+	fmt.Println()
+
+	var (
+		on  = i.Eclipse.Starts.Add(a.ROC.WaitBeforeOn.Duration)
+		off = i.Eclipse.Ends.Add(-a.ROC.TimeOff.Duration)
+	)
+	a.inspectAZM(assist.ROCON, on, "eclipse start + wait-before-on", i.RoconSaa)
+	a.inspectAZM(assist.ROCOFF, off, "eclipse end - off-duration", i.RocoffSaa)
+	fmt.Println()
+
+	for j, e := range i.Entries {
+		var moved string
+		switch e.Label {
+		case assist.ROCON:
+			moved = fmt.Sprintf(" (moved by %s)", e.When.Sub(on))
+		case assist.ROCOFF:
+			moved = fmt.Sprintf(" (moved by %s)", e.When.Sub(off))
+		}
+		conflict := "-"
+		if e.Warning {
+			conflict = "!"
+		}
+		fmt.Printf("%3d | %s | %-9s | %s%s", j+1, conflict, e.Label, e.When.Format(timefmt), moved)
+		if e.Conflict != "" {
+			fmt.Printf(" [%s]", e.Conflict)
+		}
+		fmt.Println()
+	}
+	printDropped(i.Dropped, timefmt)
+	return nil
+}
+
+func (a *Assist) inspectAZM(label string, when time.Time, from string, s assist.Period) {
+	timefmt := a.listFormat()
+	fmt.Printf("%s: default at %s (%s)", label, when.Format(timefmt), from)
+	fmt.Println()
+	if s.IsZero() {
+		fmt.Println("  no SAA crossing the eclipse")
+		return
+	}
+	enter, exit := a.ROC.EnterAZM(), a.ROC.ExitAZM()
+	if !a.ROC.TimeSAA.IsZero() && s.Duration() <= a.ROC.TimeSAA.Duration {
+		fmt.Printf("  short SAA (<= %s): AZM %s - %s", a.ROC.TimeSAA.Duration, s.Starts.Format(timefmt), s.Starts.Add(enter+exit).Format(timefmt))
+		fmt.Println()
+		return
+	}
+	fmt.Printf("  AZM SAA enter: %s - %s", s.Starts.Format(timefmt), s.Starts.Add(enter).Format(timefmt))
+	fmt.Println()
+	fmt.Printf("  AZM SAA exit : %s - %s", s.Ends.Format(timefmt), s.Ends.Add(exit).Format(timefmt))
+	fmt.Println()
+}
@@ -1,5 +1,341 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/busoc/assist"
+)
+
+const (
+	timeFormat = assist.TimeFormat
+	listFormat = "2006-01-02T15:04:05"
+)
+
+const (
+	ALLIOP = "alliop.txt"
+	INSTR  = "instrlist.txt"
+
+	MaxLineSize       = 1 << 20
+	CommentPrefix     = "#"
+	BackupSuffix      = ".bak"
+	DefaultStartDelay = 2 * time.Hour
+
+	// the spacing of the trajectory rows can differ from the resolution by
+	// 1/ResolutionTolerance of the resolution
+	ResolutionTolerance = 10
+)
+
+var (
+	ExecutionTime   time.Time
+	DefaultBaseTime time.Time
+)
+
+const (
+	Version   = "2.0.3"
+	BuildTime = "2021-01-25 07:15:00"
+	Program   = "assist"
+)
+
+func init() {
+	now := time.Now()
+	if t, err := parseSourceDate(os.Getenv("SOURCE_DATE_EPOCH")); err == nil && !t.IsZero() {
+		now = t
+	}
+	setExecutionTime(now)
+
+	log.SetOutput(os.Stderr)
+	log.SetPrefix(fmt.Sprintf("[%s-%s] ", Program, Version))
+
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, helpText)
+		os.Exit(2)
+	}
+}
+
+func setExecutionTime(t time.Time) {
+	ExecutionTime = t.Truncate(time.Second).UTC()
+	DefaultBaseTime = ExecutionTime.Add(assist.Day).Truncate(assist.Day).Add(time.Hour * 10)
+}
+
+// parseSourceDate parses a date given as a unix timestamp (like
+// SOURCE_DATE_EPOCH) or in RFC3339 format.
+func parseSourceDate(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
+
 func main() {
+	var (
+		areas  assist.Rects
+		mingap assist.Duration
+	)
+	flag.Var(&areas, "acs-area", "ACS area (N,S,W,E)")
+	flag.Var(&mingap, "min-gap", "minimum gap between scheduled blocks")
+	var (
+		baseTime = flag.String("base-time", DefaultBaseTime.Format("2006-01-02T15:04:05Z"), "schedule start time")
+		endTime  = flag.String("end-time", "", "schedule end time")
+		elist    = flag.Bool("list-entries", false, "schedule list")
+		clist    = flag.Bool("conflicts-only", false, "list only the entries in conflict")
+		noArgs   = flag.Bool("no-args-comment", false, "do not write the command line in the schedule")
+		passHdr  = flag.Bool("pass-header", false, "write the period, SAA crossings and commands of each pass before its commands")
+		backup   = flag.Bool("backup", false, "rename existing alliop and instrlist files with a .bak suffix before replacing them")
+		nocolor  = flag.Bool("no-color", false, "do not colorize the entries in conflict")
+		only     = flag.String("only", "", "list-entries only prints the entries with these labels (comma separated)")
+		plist    = flag.Bool("list-periods", false, "periods list")
+		allp     = flag.Bool("all-periods", false, "list-periods also lists the periods before base-time")
+		timeline = flag.Bool("timeline", false, "print a timeline of periods and scheduled instruments")
+		step     = flag.Duration("timeline-step", time.Minute, "time covered by one column of the timeline")
+		check    = flag.Bool("check", false, "check configuration and exit")
+		validate = flag.Bool("validate", false, "check the periods of the trajectory before scheduling")
+		trace    = flag.Bool("trace", false, "log each rule moving a command while scheduling")
+		strict   = flag.Bool("strict", false, "fail when the trajectory does not match the resolution")
+		rejectZ  = flag.Bool("reject-empty-periods", false, "fail instead of removing zero duration periods")
+		ignore   = flag.Bool("ignore", false, "keep entries that do not meet constraints")
+		conflict = flag.String("conflict", "", "ROC margin conflict resolution (shift, drop, ignore)")
+		cerAlgo  = flag.String("cer-algo", "", "CER scheduling algorithm (classic, inside, saa)")
+		acsAlone = flag.Bool("acs-without-roc", false, "schedule ACS when no ROC is scheduled")
+		workers  = flag.Int("workers", 0, "number of workers used to schedule ROC")
+		progress = flag.Bool("progress", false, "report progress while reading the trajectory")
+		format   = flag.String("format", "", "list-entries output format (text, json, ics)")
+		diff     = flag.Bool("diff", false, "compare the commands of two alliop files")
+		within   = flag.Duration("diff-tolerance", 5*time.Minute, "maximum shift of a command between two alliop files")
+		orbitPer = flag.Duration("orbit-period", 0, "orbital period used to annotate listings with orbit numbers")
+		orbitRef = flag.String("orbit-epoch", "", "start time of the reference orbit (orbit 0)")
+		precise  = flag.Bool("precise", false, "print times with microseconds in listings")
+		sod      = flag.Bool("sod", false, "print seconds of day instead of seconds of year")
+		absolute = flag.Bool("absolute-times", false, "prefix commands with their SOY instead of their delta")
+		empty    = flag.Bool("fail-empty", false, "exit with an error when no command is scheduled")
+		summary  = flag.String("summary", "", "write a JSON summary of the schedule and of its input files")
+		dump     = flag.Bool("dump-config", false, "print the effective configuration as TOML and exit")
+		srclines = flag.Bool("source-lines", false, "add the line number in the command file to the kept comments")
+		inspect  = flag.String("inspect", "", "print how the commands of the eclipse at the given time are scheduled")
+		verify   = flag.String("verify", "", "verify an alliop file against its trajectory")
+		srcDate  = flag.String("source-date", "", "execution time written in the schedule (unix timestamp or RFC3339)")
+		version  = flag.Bool("version", false, "print version and exists")
+	)
+	flag.Parse()
+
+	if *version {
+		fmt.Fprintf(os.Stderr, "%s-%s (%s)\n", Program, Version, BuildTime)
+		return
+	}
+	if *diff {
+		if flag.NArg() != 2 {
+			Exit(assist.BadUsage("diff: two alliop files are expected"))
+		}
+		Exit(DiffAlliop(flag.Arg(0), flag.Arg(1), *within))
+		return
+	}
+
+	if *srcDate != "" {
+		t, err := parseSourceDate(*srcDate)
+		if err != nil {
+			Exit(assist.BadUsage("source-date format invalid"))
+		}
+		setExecutionTime(t)
+		if !isSet("base-time") {
+			*baseTime = ""
+		}
+	}
+	base, err := time.Parse(time.RFC3339, *baseTime)
+	if err != nil && *baseTime != "" {
+		Exit(assist.BadUsage("base-time format invalid"))
+	}
+	if base.IsZero() {
+		base = DefaultBaseTime
+	}
+	var end time.Time
+	if *endTime != "" {
+		end, err = time.Parse(time.RFC3339, *endTime)
+		if err != nil {
+			Exit(assist.BadUsage("end-time format invalid"))
+		}
+	}
+	ast := Default()
+	if err := ast.Decode(flag.Arg(0)); err != nil {
+		Exit(assist.CheckError(err, nil))
+	}
+	if !isSet("base-time") && !ast.BaseTime.IsZero() {
+		base = ast.BaseTime
+	}
+	if !isSet("end-time") && !ast.EndTime.IsZero() {
+		end = ast.EndTime
+	}
+	if !end.IsZero() && !end.After(base) {
+		Exit(assist.BadUsage("end-time should be after base-time"))
+	}
+	ast.BaseTime, ast.EndTime = base, end
+	ast.ACS.Areas = append(ast.ACS.Areas, areas...)
+	if *orbitPer > 0 {
+		ast.Orbit.Period = *orbitPer
+		ast.Orbit.Epoch = base
+		if *orbitRef != "" {
+			ast.Orbit.Epoch, err = time.Parse(time.RFC3339, *orbitRef)
+			if err != nil {
+				Exit(assist.BadUsage("orbit-epoch format invalid"))
+			}
+		}
+	}
+	if *ignore {
+		ast.Ignore = true
+	}
+	if !mingap.IsZero() {
+		ast.MinGap = mingap
+	}
+	ast.FailEmpty = *empty
+	ast.Precise = *precise
+	ast.SecOfDay = *sod
+	ast.Absolute = *absolute
+	ast.Backup = *backup
+	ast.PassHeader = *passHdr
+	if *noArgs {
+		ast.NoArgs = true
+	}
+	ast.Color = !*nocolor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	if *only != "" {
+		for _, o := range strings.Split(*only, ",") {
+			ast.Only = append(ast.Only, strings.ToUpper(strings.TrimSpace(o)))
+		}
+		if err := ast.CheckLabels(ast.Only); err != nil {
+			Exit(err)
+		}
+	}
+	ast.Summary = *summary
+	ast.SourceLines = *srclines
+	ast.RejectEmpty = *rejectZ
+	ast.Strict = *strict
+	ast.Trace = *trace
+	if *workers > 0 {
+		ast.Workers = *workers
+	}
+	if *cerAlgo != "" {
+		ast.CER.Algorithm = *cerAlgo
+	}
+	if *acsAlone {
+		ast.ACS.WithoutRoc = true
+	}
+	if *conflict != "" {
+		ast.Conflict = *conflict
+	}
+	if err := ast.CheckModes(); err != nil {
+		Exit(err)
+	}
+	if ast.StartPad.Duration < 0 {
+		Exit(assist.BadUsage(fmt.Sprintf("start-padding should not be negative (%s)", ast.StartPad.Duration)))
+	}
+	if *progress {
+		ast.Progress = func(p assist.Progress) {
+			log.Printf("trajectory: %d rows read (eclipses: %d, saas: %d, auroras: %d)", p.Rows, p.Eclipses, p.Saas, p.Auroras)
+		}
+	}
+	ast.WarnSettings()
+	if *dump {
+		Exit(ast.DumpConfig(os.Stdout))
+		return
+	}
+	if *verify != "" {
+		if err := ast.Verify(*verify); err != nil {
+			Exit(err)
+		}
+		fmt.Println("OK")
+		return
+	}
+	if *check {
+		if err := ast.Validate(); err != nil {
+			Exit(err)
+		}
+		fmt.Println("OK")
+		return
+	}
+	if !*plist && !*elist && !*clist && !*timeline && *inspect == "" {
+		if err := ast.Check(); err != nil {
+			Exit(err)
+		}
+	}
+	if *inspect != "" {
+		t, err := time.Parse(time.RFC3339, *inspect)
+		if err != nil {
+			Exit(assist.BadUsage("inspect time format invalid"))
+		}
+		if err := ast.Open(); err != nil {
+			Exit(assist.CheckError(err, nil))
+		}
+		Exit(assist.CheckError(ast.Inspect(t), nil))
+		return
+	}
+	if *plist && *allp {
+		if err := ast.Open(); err != nil {
+			Exit(assist.CheckError(err, nil))
+		}
+		Exit(ast.PrintPeriods())
+		return
+	}
+	if err := ast.OpenAndFilterRange(base, end); err != nil {
+		Exit(assist.CheckError(err, nil))
+	}
+	if *validate {
+		if err := ast.Schedule.Validate(); err != nil {
+			Exit(err)
+		}
+	}
+	if *plist {
+		Exit(ast.PrintPeriods())
+		return
+	}
+	if *clist {
+		Exit(assist.CheckError(ast.PrintConflicts(), nil))
+		return
+	}
+	if *timeline {
+		Exit(assist.CheckError(ast.PrintTimeline(*step), nil))
+		return
+	}
+	if *elist {
+		switch *format {
+		case "", "text":
+			err = ast.PrintEntries()
+		case "json":
+			err = ast.PrintEntriesJSON()
+		case "ics":
+			err = ast.PrintEntriesICS()
+		default:
+			err = assist.BadUsage(fmt.Sprintf("%s: unknown format", *format))
+		}
+		Exit(assist.CheckError(err, nil))
+		return
+	}
+	err = ast.Create()
+	Exit(assist.CheckError(err, nil))
+}
+
+// isSet reports whether the flag name has been given on the command line.
+func isSet(name string) bool {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
 
+func Exit(e error) {
+	if e == nil {
+		return
+	}
+	fmt.Println(e)
+	if e, ok := e.(*assist.Error); ok {
+		os.Exit(e.Code)
+	} else {
+		os.Exit(assist.GenericErrCode)
+	}
 }
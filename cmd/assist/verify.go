@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/busoc/assist"
+)
+
+// Verify checks that the commands of an alliop file are the ones scheduled
+// again from the trajectory and the time range written in its metadata with
+// the current configuration. Missing and unexpected commands are reported per
+// label. Without trajectory in the metadata, the trajectory of the
+// configuration is used.
+func (a *Assist) Verify(file string) error {
+	al, err := readAlliop(file)
+	if err != nil {
+		return err
+	}
+	if al.Trajectory != "" {
+		a.Trajectory = al.Trajectory
+	} else {
+		log.Printf("%s: no trajectory found in metadata, using %s", file, a.Trajectory)
+	}
+	var mismatches int
+	for _, f := range al.Files {
+		if f.File != a.Trajectory {
+			continue
+		}
+		sum, err := md5File(f.File)
+		if err != nil {
+			return err
+		}
+		if sum != f.MD5 {
+			log.Printf("%s: md5 mismatch (alliop: %s, file: %s)", f.File, f.MD5, sum)
+			mismatches++
+		}
+	}
+	base := al.Base
+	if base.IsZero() {
+		base = al.When
+	}
+	if err := a.OpenAndFilterRange(base, al.End); err != nil {
+		return err
+	}
+	es, _, err := a.Schedule.ScheduleReport(a.ROC, a.CER, a.ACS)
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		SOY int64
+		Cmd string
+	}
+	found := make(map[key]int)
+	for _, c := range al.Commands {
+		found[key{SOY: c.SOY, Cmd: c.Cmd}]++
+	}
+	var (
+		labels []string
+		counts = make(map[string]int)
+	)
+	for _, e := range es {
+		cs, err := a.expectedCommands(e, al)
+		if err != nil {
+			return err
+		}
+		if _, ok := counts[e.Label]; !ok {
+			labels = append(labels, e.Label)
+		}
+		counts[e.Label] += len(cs)
+		for _, c := range cs {
+			k := key{SOY: c.SOY, Cmd: c.Cmd}
+			if found[k] > 0 {
+				found[k]--
+				continue
+			}
+			fmt.Printf("%s: %s (%s): %d | %s: expected but not found", file, e.Label, e.When.Format(timeFormat), c.SOY, c.Cmd)
+			fmt.Println()
+			mismatches++
+		}
+	}
+	for _, c := range al.Commands {
+		k := key{SOY: c.SOY, Cmd: c.Cmd}
+		if found[k] == 0 {
+			continue
+		}
+		found[k]--
+		fmt.Printf("%s:%d: %d | %s: not expected", file, c.Line, c.SOY, c.Cmd)
+		fmt.Println()
+		mismatches++
+	}
+	sort.Strings(labels)
+	for _, n := range labels {
+		log.Printf("%s: %d commands expected", n, counts[n])
+	}
+	log.Printf("%s: %d commands verified against %s", file, len(al.Commands), a.Trajectory)
+	if mismatches > 0 {
+		return fmt.Errorf("%s: %d mismatch(es) found", file, mismatches)
+	}
+	return nil
+}
+
+// expectedCommands gives the commands written in the schedule for e when the
+// schedule starts at the start time of al.
+func (a *Assist) expectedCommands(e assist.Entry, al alliop) ([]alliopCommand, error) {
+	var buf bytes.Buffer
+	if _, err := a.writeSchedule(&buf, []assist.Entry{e}, al.When); err != nil {
+		return nil, err
+	}
+	var (
+		cs []alliopCommand
+		s  = bufio.NewScanner(&buf)
+	)
+	s.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MaxLineSize)
+	for s.Scan() {
+		row := strings.TrimSpace(s.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+		delta, cmd, err := splitCommand(row)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, alliopCommand{SOY: al.Start + delta, Cmd: cmd})
+	}
+	return cs, s.Err()
+}
+
+func md5File(file string) (string, error) {
+	r, err := os.Open(file)
+	if err != nil {
+		return "", assist.CheckError(err, nil)
+	}
+	defer r.Close()
+
+	digest := md5.New()
+	if _, err := io.Copy(digest, r); err != nil {
+		return "", assist.CheckError(err, nil)
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil)), nil
+}
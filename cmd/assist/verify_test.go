@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/busoc/assist"
+)
+
+// createAlliop creates the schedule of the trajectory testdata/name with ROC,
+// CER and the sections given in extra and gives the configuration used to
+// create it.
+func createAlliop(t *testing.T, name string, base time.Time, extra ...string) *Assist {
+	t.Helper()
+	a := configAlliop(t, name, extra...)
+	if err := a.OpenAndFilter(base); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Create(); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// configAlliop gives the configuration used by createAlliop without creating
+// the schedule.
+func configAlliop(t *testing.T, name string, extra ...string) *Assist {
+	t.Helper()
+	var (
+		dir = t.TempDir()
+		cfg = strings.Join([]string{
+			`alliop="` + filepath.Join(dir, "alliop.txt") + `"`,
+			`instrlist="` + filepath.Join(dir, "instrlist.txt") + `"`,
+			`path="` + filepath.Join("..", "..", "testdata", name) + `"`,
+			`resolution="10s"`,
+			`no-args-comment=true`,
+			`[roc]`,
+			`on-cmd="CMD ROCON"`,
+			`off-cmd="CMD ROCOFF"`,
+			`[cer]`,
+			`on-cmd="CMD CERON"`,
+			`off-cmd="CMD CEROFF"`,
+		}, "\n") + "\n" + strings.Join(extra, "\n") + "\n"
+	)
+	a := Default()
+	if err := a.Decode(writeConfig(t, cfg)); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestVerify(t *testing.T) {
+	base := time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+	data := []struct {
+		Name   string
+		Change func(string) string
+		Fail   bool
+	}{
+		{Name: "same"},
+		{
+			Name:   "moved",
+			Change: func(str string) string { return strings.Replace(str, " CMD ROCON", "0 CMD ROCON", 1) },
+			Fail:   true,
+		},
+		{
+			Name:   "removed",
+			Change: func(str string) string { return regexp.MustCompile(`(?m)^\d+ CMD CEROFF\n`).ReplaceAllString(str, "") },
+			Fail:   true,
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			a := createAlliop(t, "saa-split.csv", base)
+			if d.Change != nil {
+				buf, err := os.ReadFile(a.Alliop)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(a.Alliop, []byte(d.Change(string(buf))), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			v := Default()
+			v.ROC, v.CER = a.ROC, a.CER
+			v.inline = a.inline
+			err := v.Verify(a.Alliop)
+			if d.Fail && err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if !d.Fail && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestCreateEmpty(t *testing.T) {
+	var (
+		base  = time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+		after = base.Add(assist.Day)
+	)
+	for _, fail := range []bool{false, true} {
+		a := createAlliop(t, "saa-split.csv", base)
+		e := Default()
+		e.Alliop, e.Instr, e.Trajectory = a.Alliop, a.Instr, a.Trajectory
+		e.ROC, e.inline = a.ROC, a.inline
+		e.FailEmpty = fail
+		if err := e.OpenAndFilter(after); err != nil {
+			t.Fatal(err)
+		}
+		err := e.Create()
+		if fail {
+			if err == nil {
+				t.Errorf("fail-empty: expected error but got none")
+			}
+			// the previous schedule is kept
+			al, err := readAlliop(a.Alliop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(al.Commands) == 0 {
+				t.Errorf("fail-empty: previous alliop replaced")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		al, err := readAlliop(a.Alliop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(al.Commands) > 0 || !al.Base.Equal(after) {
+			t.Errorf("alliop: want no commands after %s, got %d after %s", after, len(al.Commands), al.Base)
+		}
+		if buf, err := os.ReadFile(a.Instr); err != nil || len(buf) > 0 {
+			t.Errorf("instrlist: want empty file, got %q (%v)", buf, err)
+		}
+	}
+}
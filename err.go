@@ -1,4 +1,4 @@
-package main
+package assist
 
 import (
 	"encoding/csv"
@@ -17,6 +17,8 @@ const (
 	GenericErrCode = 5000 + iota
 	MissingFileErrCode
 	SameFileErrCode
+	EmptyScheduleErrCode
+	InvalidScheduleErrCode
 )
 
 type Error struct {
@@ -28,27 +30,15 @@ func (e *Error) Error() string {
 	return e.Cause.Error()
 }
 
-func Exit(e error) {
-	if e == nil {
-		return
-	}
-	fmt.Println(e)
-	if e, ok := e.(*Error); ok {
-		os.Exit(e.Code)
-	} else {
-		os.Exit(GenericErrCode)
-	}
-}
-
-func checkError(err, parent error) error {
+func CheckError(err, parent error) error {
 	if err == nil {
 		return nil
 	}
 	switch e := err.(type) {
 	case *csv.ParseError:
-		return badUsage(e.Error())
+		return BadUsage(e.Error())
 	case *os.PathError:
-		return checkError(e.Err, err)
+		return CheckError(e.Err, err)
 	case syscall.Errno:
 		if parent != nil {
 			err = parent
@@ -59,7 +49,7 @@ func checkError(err, parent error) error {
 	}
 }
 
-func badUsage(n string) error {
+func BadUsage(n string) error {
 	e := Error{
 		Cause: fmt.Errorf(n),
 		Code:  EINVAL,
@@ -83,6 +73,14 @@ func timeBadSyntax(i int, v string) error {
 	return &e
 }
 
+func columnsBadCount(i, n int) error {
+	e := Error{
+		Cause: fmt.Errorf("wrong number of columns at row %d (found: %d, expected: %d)", i+1, n, PredictColumns),
+		Code:  EINVAL,
+	}
+	return &e
+}
+
 func genericErr(n string) error {
 	e := Error{
 		Cause: fmt.Errorf(n),
@@ -99,10 +97,26 @@ func sameFile(n string) error {
 	return &e
 }
 
-func missingFile(n string) error {
+func MissingFile(n string) error {
 	e := Error{
 		Cause: fmt.Errorf("%s: files should be provided by pair (on/off)", strings.ToUpper(n)),
 		Code:  MissingFileErrCode,
 	}
 	return &e
 }
+
+func invalidSchedule(p Period, n string) error {
+	e := Error{
+		Cause: fmt.Errorf("invalid schedule: %s %s - %s: %s", p.Label, p.Starts.Format(TimeFormat), p.Ends.Format(TimeFormat), n),
+		Code:  InvalidScheduleErrCode,
+	}
+	return &e
+}
+
+func EmptySchedule(n string) error {
+	e := Error{
+		Cause: fmt.Errorf("empty schedule: %s", n),
+		Code:  EmptyScheduleErrCode,
+	}
+	return &e
+}
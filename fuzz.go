@@ -0,0 +1,25 @@
+//go:build gofuzz
+// +build gofuzz
+
+package assist
+
+import (
+	"bytes"
+)
+
+// Fuzz feeds data to OpenReader as a trajectory. It is the entry point used by
+// go-fuzz (https://github.com/dvyukov/go-fuzz).
+func Fuzz(data []byte) int {
+	area := Rect{North: 90, South: 45, West: -180, East: 180}
+	s, err := OpenReader(bytes.NewReader(data), area)
+	if err != nil {
+		if _, ok := err.(*Error); !ok {
+			panic(err)
+		}
+		return 0
+	}
+	if s == nil {
+		panic("nil schedule without error")
+	}
+	return 1
+}
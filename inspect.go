@@ -0,0 +1,62 @@
+package assist
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Inspection gives the details of the scheduling of a single eclipse: the
+// periods crossing it, the SAA selected for ROCON and ROCOFF and the entries
+// scheduled for it.
+type Inspection struct {
+	Eclipse Period
+	Saas    []Period
+	Auroras []Period
+
+	RoconSaa  Period
+	RocoffSaa Period
+
+	Entries []Entry
+	Dropped []Drop
+}
+
+// Inspect schedules the commands of the eclipse containing t as if it was the
+// only eclipse of s.
+func (s *Schedule) Inspect(t time.Time, roc RocOption, cer CerOption, aur AuroraOption) (Inspection, error) {
+	var (
+		i Inspection
+		x = sort.Search(len(s.Eclipses), func(i int) bool {
+			return !s.Eclipses[i].Ends.Before(t)
+		})
+	)
+	if x >= len(s.Eclipses) || t.Before(s.Eclipses[x].Starts) {
+		return i, BadUsage(fmt.Sprintf("no eclipse at %s", t.Format(TimeFormat)))
+	}
+	i.Eclipse = s.Eclipses[x]
+	for _, a := range s.Saas {
+		if a.Overlaps(i.Eclipse) {
+			i.Saas = append(i.Saas, a)
+		}
+	}
+	for _, a := range s.Auroras {
+		if a.Overlaps(i.Eclipse) {
+			i.Auroras = append(i.Auroras, a)
+		}
+	}
+	i.RoconSaa, i.RocoffSaa = selectCrossing(i.Eclipse, i.Saas, roc.Crossing)
+
+	c := *s
+	c.Eclipses = []Period{i.Eclipse}
+	c.Saas = i.Saas
+	c.Auroras = i.Auroras
+	c.dropped = nil
+	c.skipped = nil
+
+	es, err := c.Schedule(roc, cer, aur)
+	if err != nil {
+		return i, err
+	}
+	i.Entries, i.Dropped = es, c.dropped
+	return i, nil
+}
@@ -0,0 +1,72 @@
+package assist
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// InstrumentOption describes an instrument scheduled like ROC: switched on at
+// the start of each eclipse (or daylight) and switched off at its end, with
+// its own command files, durations and AZM margins.
+type InstrumentOption struct {
+	Name  string `toml:"name"`
+	Instr string `toml:"instrlist"`
+
+	RocOption
+}
+
+func (i InstrumentOption) Labels() (string, string) {
+	return i.Name + "ON", i.Name + "OFF"
+}
+
+func (i InstrumentOption) Check() error {
+	if err := i.CheckName(); err != nil {
+		return err
+	}
+	return i.RocOption.Check()
+}
+
+// CheckName checks that the instrument has a name and that it is not the one
+// of a builtin instrument, whatever its case (eg: roc). Labels, on the other
+// hand, are matched exactly (see Instrument).
+func (i InstrumentOption) CheckName() error {
+	if i.Name == "" {
+		return BadUsage("instrument: name is missing")
+	}
+	switch strings.ToUpper(i.Name) {
+	case InstrROC, InstrCER, InstrACS:
+		return BadUsage(fmt.Sprintf("instrument: %s is a builtin instrument", i.Name))
+	}
+	return nil
+}
+
+func lookupInstrument(label string, is []InstrumentOption) (InstrumentOption, bool) {
+	for _, i := range is {
+		if on, off := i.Labels(); label == on || label == off {
+			return i, true
+		}
+	}
+	return InstrumentOption{}, false
+}
+
+func (s *Schedule) runInstrument(ctx context.Context, i InstrumentOption) ([]Entry, error) {
+	n := len(s.dropped)
+	es, err := s.runROC(ctx, i.RocOption)
+	if err != nil {
+		return nil, err
+	}
+	on, off := i.Labels()
+	for j := range es {
+		switch es[j].Label {
+		case ROCON:
+			es[j].Label = on
+		case ROCOFF:
+			es[j].Label = off
+		}
+	}
+	for j := n; j < len(s.dropped); j++ {
+		s.dropped[j].Label = on
+	}
+	return es, nil
+}
@@ -1,4 +1,4 @@
-package main
+package assist
 
 import (
 	"time"
@@ -7,9 +7,15 @@ import (
 type Period struct {
 	Label        string
 	Starts, Ends time.Time
+
+	// Area is the name of the area where an aurora period has been found
+	Area string
 }
 
+// Duration gives the time between the start and the end of p, whatever their
+// order.
 func (p Period) Duration() time.Duration {
+	p = p.Normalize()
 	return p.Ends.Sub(p.Starts)
 }
 
@@ -17,29 +23,95 @@ func (p Period) IsZero() bool {
 	return p.Starts.IsZero() && p.Ends.IsZero()
 }
 
-func (p Period) Contains(o Period) bool {
-	if o.Starts.Before(p.Starts) {
-		return false
+// Normalize returns p with its bounds swapped when it ends before it starts.
+func (p Period) Normalize() Period {
+	if p.Ends.Before(p.Starts) {
+		p.Starts, p.Ends = p.Ends, p.Starts
 	}
-	return o.Starts.Add(o.Duration()).Before(p.Ends)
+	return p
+}
+
+func (p Period) Contains(o Period) bool {
+	p, o = p.Normalize(), o.Normalize()
+	return !o.Starts.Before(p.Starts) && !o.Ends.After(p.Ends)
 }
 
 func (p Period) Overlaps(o Period) bool {
+	p, o = p.Normalize(), o.Normalize()
 	return !(o.Starts.After(p.Ends) || o.Ends.Before(p.Starts))
 }
 
 func (p Period) Intersect(o Period) time.Duration {
+	p, o = p.Normalize(), o.Normalize()
 	if !p.Overlaps(o) {
 		return 0
 	}
-	if p.Contains(o) {
-		return o.Duration()
+	var (
+		starts = p.Starts
+		ends   = p.Ends
+	)
+	if o.Starts.After(starts) {
+		starts = o.Starts
+	}
+	if o.Ends.Before(ends) {
+		ends = o.Ends
+	}
+	return ends.Sub(starts)
+}
+
+func (p Period) Union(o Period) Period {
+	p, o = p.Normalize(), o.Normalize()
+	u := p
+	if o.Starts.Before(u.Starts) {
+		u.Starts = o.Starts
+	}
+	if o.Ends.After(u.Ends) {
+		u.Ends = o.Ends
+	}
+	return u
+}
+
+// Gap gives the time between the end of the first of p and o and the start of
+// the other one. It is negative when they overlap.
+func (p Period) Gap(o Period) time.Duration {
+	p, o = p.Normalize(), o.Normalize()
+	if o.Starts.Before(p.Starts) {
+		return p.Starts.Sub(o.Ends)
+	}
+	return o.Starts.Sub(p.Ends)
+}
+
+// Split cuts p at the given time. It reports false, and gives p (normalized),
+// when at is not strictly between the start and the end of p.
+func (p Period) Split(at time.Time) (Period, Period, bool) {
+	p = p.Normalize()
+	if !at.After(p.Starts) || !at.Before(p.Ends) {
+		return p, Period{}, false
+	}
+	before, after := p, p
+	before.Ends, after.Starts = at, at
+	return before, after, true
+}
+
+type Orbit struct {
+	Epoch  time.Time
+	Period time.Duration
+}
+
+func (o Orbit) IsZero() bool {
+	return o.Period <= 0
+}
+
+// Number gives the index of the orbit t belongs to, counting from the orbit
+// starting at Epoch (orbit 0).
+func (o Orbit) Number(t time.Time) int64 {
+	if o.IsZero() {
+		return 0
 	}
-	var delta time.Duration
-	if p.Starts.After(o.Starts) {
-		delta = o.Ends.Sub(p.Starts)
-	} else {
-		delta = p.Ends.Sub(o.Starts)
+	d := t.Sub(o.Epoch)
+	n := int64(d / o.Period)
+	if d < 0 && d%o.Period != 0 {
+		n--
 	}
-	return delta
+	return n
 }
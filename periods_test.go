@@ -0,0 +1,151 @@
+package assist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodContains(t *testing.T) {
+	data := []struct {
+		Name  string
+		Outer Period
+		Inner Period
+		Want  bool
+	}{
+		{Name: "inside", Outer: period("", 0, 100), Inner: period("", 10, 90), Want: true},
+		{Name: "same", Outer: period("", 0, 100), Inner: period("", 0, 100), Want: true},
+		{Name: "same-start", Outer: period("", 0, 100), Inner: period("", 0, 50), Want: true},
+		{Name: "same-end", Outer: period("", 0, 100), Inner: period("", 50, 100), Want: true},
+		{Name: "instant-end", Outer: period("", 0, 100), Inner: period("", 100, 100), Want: true},
+		{Name: "before", Outer: period("", 10, 100), Inner: period("", 0, 50)},
+		{Name: "after", Outer: period("", 0, 100), Inner: period("", 50, 101)},
+		{Name: "larger", Outer: period("", 10, 90), Inner: period("", 0, 100)},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			if got := d.Outer.Contains(d.Inner); got != d.Want {
+				t.Errorf("want %t, got %t", d.Want, got)
+			}
+		})
+	}
+}
+
+func TestPeriodIntersect(t *testing.T) {
+	data := []struct {
+		Name string
+		P    Period
+		O    Period
+		Want time.Duration
+	}{
+		{Name: "left-overlap", P: period("", 50, 150), O: period("", 0, 100), Want: 50 * time.Second},
+		{Name: "right-overlap", P: period("", 0, 100), O: period("", 60, 200), Want: 40 * time.Second},
+		{Name: "containment", P: period("", 0, 100), O: period("", 20, 30), Want: 10 * time.Second},
+		{Name: "contained", P: period("", 20, 30), O: period("", 0, 100), Want: 10 * time.Second},
+		{Name: "flush", P: period("", 0, 100), O: period("", 50, 100), Want: 50 * time.Second},
+		{Name: "touching", P: period("", 0, 100), O: period("", 100, 200)},
+		{Name: "disjoint", P: period("", 0, 100), O: period("", 150, 200)},
+		{Name: "inverted", P: period("", 100, 0), O: period("", 50, 150), Want: 50 * time.Second},
+		{Name: "both-inverted", P: period("", 100, 0), O: period("", 150, 50), Want: 50 * time.Second},
+		{Name: "inverted-disjoint", P: period("", 100, 0), O: period("", 200, 150)},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			if got := d.P.Intersect(d.O); got != d.Want {
+				t.Errorf("want %s, got %s", d.Want, got)
+			}
+		})
+	}
+}
+
+func TestPeriodUnion(t *testing.T) {
+	data := []struct {
+		Name string
+		P    Period
+		O    Period
+		Want Period
+	}{
+		{Name: "overlap", P: period("", 0, 100), O: period("", 50, 150), Want: period("", 0, 150)},
+		{Name: "reversed", P: period("", 50, 150), O: period("", 0, 100), Want: period("", 0, 150)},
+		{Name: "disjoint", P: period("", 0, 10), O: period("", 90, 100), Want: period("", 0, 100)},
+		{Name: "nested", P: period("", 0, 100), O: period("", 20, 30), Want: period("", 0, 100)},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			got := d.P.Union(d.O)
+			if !got.Starts.Equal(d.Want.Starts) || !got.Ends.Equal(d.Want.Ends) {
+				t.Errorf("want %s-%s, got %s-%s", d.Want.Starts, d.Want.Ends, got.Starts, got.Ends)
+			}
+		})
+	}
+}
+
+func TestPeriodGap(t *testing.T) {
+	data := []struct {
+		Name string
+		P    Period
+		O    Period
+		Want time.Duration
+	}{
+		{Name: "after", P: period("", 0, 100), O: period("", 130, 200), Want: 30 * time.Second},
+		{Name: "before", P: period("", 130, 200), O: period("", 0, 100), Want: 30 * time.Second},
+		{Name: "touching", P: period("", 0, 100), O: period("", 100, 200)},
+		{Name: "overlap", P: period("", 0, 100), O: period("", 80, 200), Want: -20 * time.Second},
+		{Name: "inverted", P: period("", 100, 0), O: period("", 130, 200), Want: 30 * time.Second},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			if got := d.P.Gap(d.O); got != d.Want {
+				t.Errorf("want %s, got %s", d.Want, got)
+			}
+		})
+	}
+}
+
+func TestPeriodDuration(t *testing.T) {
+	data := []struct {
+		Name string
+		P    Period
+		Want time.Duration
+	}{
+		{Name: "ordered", P: period("", 0, 100), Want: 100 * time.Second},
+		{Name: "inverted", P: period("", 100, 0), Want: 100 * time.Second},
+		{Name: "empty", P: period("", 100, 100)},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			if got := d.P.Duration(); got != d.Want {
+				t.Errorf("want %s, got %s", d.Want, got)
+			}
+		})
+	}
+}
+
+func TestPeriodSplit(t *testing.T) {
+	data := []struct {
+		Name   string
+		P      Period
+		At     int
+		Before Period
+		After  Period
+		Want   bool
+	}{
+		{Name: "inside", P: period("", 0, 100), At: 40, Before: period("", 0, 40), After: period("", 40, 100), Want: true},
+		{Name: "at-start", P: period("", 0, 100), At: 0, Before: period("", 0, 100)},
+		{Name: "at-end", P: period("", 0, 100), At: 100, Before: period("", 0, 100)},
+		{Name: "before", P: period("", 10, 100), At: 0, Before: period("", 10, 100)},
+		{Name: "after", P: period("", 0, 100), At: 150, Before: period("", 0, 100)},
+		{Name: "inverted", P: period("", 100, 0), At: 40, Before: period("", 0, 40), After: period("", 40, 100), Want: true},
+		{Name: "inverted-outside", P: period("", 100, 0), At: 150, Before: period("", 0, 100)},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			before, after, ok := d.P.Split(at(d.At))
+			if ok != d.Want {
+				t.Fatalf("want %t, got %t", d.Want, ok)
+			}
+			if before != d.Before || after != d.After {
+				t.Errorf("want %v and %v, got %v and %v", d.Before, d.After, before, after)
+			}
+		})
+	}
+}
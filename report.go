@@ -0,0 +1,288 @@
+package assist
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	InstrROC = "ROC"
+	InstrCER = "CER"
+	InstrACS = "ACS"
+)
+
+type Drop struct {
+	Label  string
+	Reason string
+	Period
+}
+
+type Usage struct {
+	Count    int
+	Duration time.Duration
+}
+
+type DailyUsage struct {
+	Day         time.Time
+	Instruments map[string]Usage
+}
+
+func (d DailyUsage) Usage(instr string) Usage {
+	return d.Instruments[instr]
+}
+
+type Report struct {
+	Eclipses int
+	Saas     int
+	Auroras  int
+
+	Scheduled int
+	Dropped   []Drop
+	// Skipped gives by reason the number of auroras rejected before ACSON is
+	// scheduled. The ACSON dropped because of a conflict are in Dropped.
+	Skipped     map[string]int
+	Conflicts   []Entry
+	Instruments map[string]Usage
+	Days        []DailyUsage
+
+	Peak        int
+	PeakWindows []Period
+}
+
+func (r Report) Usage(instr string) Usage {
+	return r.Instruments[instr]
+}
+
+// Stats gives the number and the total duration of the periods of a schedule
+// by label (eclipse, saa, aurora).
+type Stats map[string]Usage
+
+func PeriodStats(s *Schedule) Stats {
+	st := make(Stats)
+	for _, p := range s.Periods() {
+		u := st[p.Label]
+		u.Count++
+		u.Duration += p.Duration()
+		st[p.Label] = u
+	}
+	return st
+}
+
+func (s *Schedule) ScheduleReport(roc RocOption, cer CerOption, aur AuroraOption) ([]Entry, Report, error) {
+	es, err := s.Schedule(roc, cer, aur)
+	if err != nil {
+		return nil, Report{}, err
+	}
+	r := Report{
+		Eclipses:  len(s.Eclipses),
+		Saas:      len(s.Saas),
+		Auroras:   len(s.Auroras),
+		Scheduled: len(es),
+		Dropped:   append([]Drop{}, s.dropped...),
+		Skipped:   make(map[string]int),
+	}
+	for _, d := range s.skipped {
+		r.Skipped[d.Reason]++
+	}
+	for _, e := range es {
+		if e.Warning {
+			r.Conflicts = append(r.Conflicts, e)
+		}
+	}
+	r.Instruments, r.Days = Usages(es, roc, cer, aur, s.Instruments...)
+	r.Peak, r.PeakWindows = Concurrency(es, roc, cer, aur, s.Instruments...)
+	return es, r, nil
+}
+
+// Usages gives the number and the total duration of the commands of es by
+// instrument, for all of them and by UTC day.
+func Usages(es []Entry, roc RocOption, cer CerOption, aur AuroraOption, is ...InstrumentOption) (map[string]Usage, []DailyUsage) {
+	var (
+		total = make(map[string]Usage)
+		days  []DailyUsage
+	)
+	for _, e := range es {
+		instr := Instrument(e.Label, is...)
+		if instr == "" {
+			continue
+		}
+		d := EntryDuration(e, roc, cer, aur, is...)
+
+		u := total[instr]
+		u.Count++
+		u.Duration += d
+		total[instr] = u
+
+		day := e.When.Truncate(Day)
+		if n := len(days); n == 0 || !days[n-1].Day.Equal(day) {
+			days = append(days, DailyUsage{
+				Day:         day,
+				Instruments: make(map[string]Usage),
+			})
+		}
+		u = days[len(days)-1].Instruments[instr]
+		u.Count++
+		u.Duration += d
+		days[len(days)-1].Instruments[instr] = u
+	}
+	return total, days
+}
+
+// Blocks returns the windows where each instrument is on, from the start of
+// its ON block until the end of its OFF block. The windows are labelled with
+// the instrument name and sorted by start time.
+func Blocks(es []Entry, roc RocOption, cer CerOption, aur AuroraOption, is ...InstrumentOption) []Period {
+	var (
+		bs   []Period
+		last time.Time
+	)
+	for _, e := range es {
+		if ends := e.When.Add(EntryDuration(e, roc, cer, aur, is...)); ends.After(last) {
+			last = ends
+		}
+	}
+	for _, g := range pairEntries(es, is...) {
+		on, off := es[g[0]], es[g[len(g)-1]]
+		instr := Instrument(on.Label, is...)
+		if instr == "" || !strings.HasSuffix(on.Label, "ON") {
+			continue
+		}
+		b := Period{Label: instr, Starts: on.When, Ends: last}
+		if strings.HasSuffix(off.Label, "OFF") {
+			b.Ends = off.When.Add(EntryDuration(off, roc, cer, aur, is...))
+		}
+		bs = append(bs, b)
+	}
+	sort.SliceStable(bs, func(i, j int) bool {
+		return bs[i].Starts.Before(bs[j].Starts)
+	})
+	return bs
+}
+
+// pairEntries groups the indices of es by block: an ON command with the
+// following commands of the same instrument until its OFF command. The other
+// entries are a block on their own. The blocks are ordered by their first
+// entry.
+func pairEntries(es []Entry, is ...InstrumentOption) [][]int {
+	var (
+		gs   [][]int
+		open = make(map[string]int)
+	)
+	for i, e := range es {
+		instr := Instrument(e.Label, is...)
+		j, ok := open[instr]
+		switch {
+		case instr != "" && ok:
+			gs[j] = append(gs[j], i)
+			if strings.HasSuffix(e.Label, "OFF") {
+				delete(open, instr)
+			}
+		case instr != "" && strings.HasSuffix(e.Label, "ON"):
+			open[instr] = len(gs)
+			gs = append(gs, []int{i})
+		default:
+			gs = append(gs, []int{i})
+		}
+	}
+	return gs
+}
+
+// blockSpan gives the window of the entries of es at the indices of g, from
+// the first command until the latest end of its commands.
+func blockSpan(es []Entry, g []int, roc RocOption, cer CerOption, aur AuroraOption, is ...InstrumentOption) Period {
+	w := Period{
+		Label:  es[g[0]].Label,
+		Starts: es[g[0]].When,
+		Ends:   es[g[0]].When,
+	}
+	for _, i := range g {
+		if ends := es[i].When.Add(EntryDuration(es[i], roc, cer, aur, is...)); ends.After(w.Ends) {
+			w.Ends = ends
+		}
+	}
+	return w
+}
+
+// Concurrency computes the maximum number of instruments switched on at the
+// same time and the windows where this maximum is reached.
+func Concurrency(es []Entry, roc RocOption, cer CerOption, aur AuroraOption, is ...InstrumentOption) (int, []Period) {
+	type event struct {
+		When  time.Time
+		Instr string
+		On    bool
+	}
+	var evs []event
+	for _, b := range Blocks(es, roc, cer, aur, is...) {
+		evs = append(evs, event{When: b.Starts, Instr: b.Label, On: true}, event{When: b.Ends, Instr: b.Label})
+	}
+	sort.SliceStable(evs, func(i, j int) bool {
+		if evs[i].When.Equal(evs[j].When) {
+			return !evs[i].On && evs[j].On
+		}
+		return evs[i].When.Before(evs[j].When)
+	})
+
+	var (
+		peak    int
+		windows []Period
+		active  = make(map[string]int)
+	)
+	for i, ev := range evs {
+		if ev.On {
+			active[ev.Instr]++
+		} else {
+			active[ev.Instr]--
+			if active[ev.Instr] == 0 {
+				delete(active, ev.Instr)
+			}
+		}
+		if i+1 >= len(evs) || !evs[i+1].When.After(ev.When) {
+			continue
+		}
+		n := len(active)
+		if n == 0 || n < peak {
+			continue
+		}
+		if n > peak {
+			peak, windows = n, windows[:0]
+		}
+		w := Period{
+			Label:  activeLabel(active),
+			Starts: ev.When,
+			Ends:   evs[i+1].When,
+		}
+		if k := len(windows) - 1; k >= 0 && windows[k].Ends.Equal(w.Starts) && windows[k].Label == w.Label {
+			windows[k].Ends = w.Ends
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return peak, windows
+}
+
+func activeLabel(active map[string]int) string {
+	xs := make([]string, 0, len(active))
+	for instr := range active {
+		xs = append(xs, instr)
+	}
+	sort.Strings(xs)
+	return strings.Join(xs, "+")
+}
+
+// Instrument gives the name of the instrument of label: ROC, CER and ACS for
+// their labels, the name of one of the instruments is otherwise.
+func Instrument(label string, is ...InstrumentOption) string {
+	switch label {
+	case ROCON, ROCOFF:
+		return InstrROC
+	case CERON, CEROFF:
+		return InstrCER
+	case ACSON, ACSOFF:
+		return InstrACS
+	}
+	if i, ok := lookupInstrument(label, is); ok {
+		return i.Name
+	}
+	return ""
+}
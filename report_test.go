@@ -0,0 +1,139 @@
+package assist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInstrument(t *testing.T) {
+	is := []InstrumentOption{{Name: "ROCKET"}, {Name: "CERES"}}
+	data := []struct {
+		Label string
+		Want  string
+	}{
+		{Label: ROCON, Want: InstrROC},
+		{Label: ROCOFF, Want: InstrROC},
+		{Label: CERON, Want: InstrCER},
+		{Label: CEROFF, Want: InstrCER},
+		{Label: ACSON, Want: InstrACS},
+		{Label: ACSOFF, Want: InstrACS},
+		{Label: "ROCKETON", Want: "ROCKET"},
+		{Label: "ROCKETOFF", Want: "ROCKET"},
+		{Label: "CERESON", Want: "CERES"},
+		{Label: "ROCKET"},
+		{Label: "ACSWHATEVER"},
+	}
+	for _, d := range data {
+		t.Run(d.Label, func(t *testing.T) {
+			if got := Instrument(d.Label, is...); got != d.Want {
+				t.Errorf("want %q, got %q", d.Want, got)
+			}
+		})
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	data := []struct {
+		Name string
+		Fail bool
+	}{
+		{Name: "", Fail: true},
+		{Name: "ROC", Fail: true},
+		{Name: "roc", Fail: true},
+		{Name: "Cer", Fail: true},
+		{Name: "rocon"},
+		{Name: "LIS"},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			err := InstrumentOption{Name: d.Name}.CheckName()
+			if d.Fail && err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if !d.Fail && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+	// the labels of an instrument named rocon are not the builtin ones
+	is := []InstrumentOption{{Name: "rocon"}}
+	for label, want := range map[string]string{ROCON: InstrROC, "roconON": "rocon", "roconOFF": "rocon"} {
+		if got := Instrument(label, is...); got != want {
+			t.Errorf("%s: want %q, got %q", label, want, got)
+		}
+	}
+}
+
+func TestScheduleInstruments(t *testing.T) {
+	rocket := InstrumentOption{
+		Name: "ROCKET",
+		RocOption: RocOption{
+			Fileset: Fileset{On: "on.txt", Off: "off.txt"},
+			TimeOn:  NewDuration(60),
+			TimeOff: NewDuration(90),
+		},
+	}
+	run := func(is ...InstrumentOption) Report {
+		s := Schedule{
+			Eclipses:    []Period{period("eclipse", 0, 2000)},
+			Instruments: is,
+		}
+		_, r, err := s.ScheduleReport(RocOption{}, CerOption{}, AuroraOption{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	r := run(rocket)
+	if u := r.Usage("ROCKET"); u.Count != 2 || u.Duration != 150*time.Second {
+		t.Errorf("ROCKET: want 2 commands for 2m30s, got %d for %s", u.Count, u.Duration)
+	}
+	// instruments of a schedule are not seen by another one
+	if r := run(); r.Scheduled != 0 || len(r.Instruments) != 0 {
+		t.Errorf("expected nothing scheduled, got %d commands", r.Scheduled)
+	}
+	bad := rocket
+	bad.Name = InstrCER
+	s := Schedule{Instruments: []InstrumentOption{bad}}
+	if _, err := s.Schedule(RocOption{}, CerOption{}, AuroraOption{}); err == nil {
+		t.Errorf("expected error for instrument named %s", InstrCER)
+	}
+}
+
+func TestReportCounts(t *testing.T) {
+	s := Schedule{
+		Eclipses: []Period{period("eclipse", 0, 3000)},
+		Auroras: []Period{
+			period("aurora", 100, 200),
+			period("aurora", 500, 1000),
+			period("aurora", 1500, 2000),
+		},
+		Blackouts: []Period{period("blackout", 1600, 1700)},
+	}
+	aur := AuroraOption{
+		Fileset:    Fileset{On: "acson.txt", Off: "acsoff.txt"},
+		Night:      NewDuration(300),
+		Time:       NewDuration(20),
+		WithoutRoc: true,
+	}
+	es, r, err := s.ScheduleReport(RocOption{}, CerOption{}, aur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scheduled, skipped int
+	for _, e := range es {
+		if e.Label == ACSON {
+			scheduled++
+		}
+	}
+	for _, n := range r.Skipped {
+		skipped += n
+	}
+	// each aurora is either scheduled, dropped or skipped
+	if got := scheduled + len(r.Dropped) + skipped; got != len(s.Auroras) {
+		t.Errorf("auroras: want %d, got %d (scheduled: %d, dropped: %d, skipped: %d)", len(s.Auroras), got, scheduled, len(r.Dropped), skipped)
+	}
+	if r.Skipped[SkipTooShort] != 1 || len(r.Dropped) != 1 || scheduled != 1 {
+		t.Errorf("want 1 aurora scheduled, dropped and skipped, got %d, %d and %v", scheduled, len(r.Dropped), r.Skipped)
+	}
+}
@@ -1,12 +1,22 @@
-package main
+// Package assist computes the ROC, CER and ACS command schedules of ASIM from
+// a predicted trajectory of the ISS.
+//
+// A Schedule is built from a trajectory with Open or OpenReader. Once its
+// options (Ignore, MinGap, Conflict, Blackouts) are set, Schedule returns the
+// list of entries for the given instrument options. The assist command in
+// cmd/assist is a thin wrapper around this package.
+package assist
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,6 +31,8 @@ const (
 	PredictComment      = '#'
 )
 
+const TimeFormat = "2006-01-02T15:04:05.000000"
+
 const Leap = 18 * time.Second
 
 const (
@@ -29,13 +41,37 @@ const (
 	Five             = time.Second * 5
 )
 
+const (
+	ConflictRocMargin = "roc-margin"
+	ConflictRocOrder  = "roc-order"
+	ConflictMinGap    = "min-gap"
+	ConflictBlackout  = "blackout"
+	ConflictRocLimit  = "roc-limit"
+	ConflictCerOrder  = "cer-order"
+	ConflictCerMinOn  = "cer-min-on"
+	ConflictAcsRocon  = "acs-rocon-overlap"
+	ConflictAcsRocoff = "acs-rocoff-overlap"
+)
+
+// SkipTooShort is the reason given for the auroras not accepted by the ACS
+// options.
+const SkipTooShort = "too-short"
+
 type Entry struct {
-	Label   string
-	When    time.Time
-	Warning bool
+	Label    string
+	When     time.Time
+	Warning  bool
+	Conflict string
 	Period
 }
 
+func (e *Entry) Flag(conflict string) {
+	e.Warning = true
+	if e.Conflict == "" {
+		e.Conflict = conflict
+	}
+}
+
 func (e Entry) IsZero() bool {
 	return e.When.IsZero()
 }
@@ -46,29 +82,151 @@ func SOY(t time.Time) int64 {
 	return stamp.Unix() - year.Unix()
 }
 
+// SOD gives the seconds of the day of t with the same GPS leap seconds as SOY.
+func SOD(t time.Time) int64 {
+	day := t.Truncate(Day)
+	stamp := t.Add(Leap)
+	return stamp.Unix() - day.Unix()
+}
+
 func (e Entry) SOY() int64 {
 	return SOY(e.When)
 }
 
 type Schedule struct {
-	Ignore   bool
-	Eclipses []Period
-	Saas     []Period
-	Auroras  []Period
+	Ignore    bool
+	MinGap    time.Duration
+	Conflict  string
+	Workers   int
+	Blackouts []Period
+	// Instruments are the additional instruments, scheduled with the ROC rules
+	// after ROC, CER and ACS which keep their own rules.
+	Instruments []InstrumentOption
+	Eclipses    []Period
+	Saas        []Period
+	Auroras     []Period
+
+	// Spacing is the most frequent interval between two rows of the trajectory.
+	Spacing time.Duration
+	// Origin is the start of the first window used to limit the number of ROC
+	// blocks when RocOption.MaxWindow is set. The windows are aligned on the
+	// Unix epoch when it is zero.
+	Origin time.Time
+	// Trace, when set, is called each time a rule moves an entry. With more
+	// than one worker, it is called from several goroutines at once.
+	Trace TraceFunc
+
+	dropped []Drop
+	skipped []Drop
+	removed []Period
 }
 
 func Open(p string, area Shape) (*Schedule, error) {
 	r, err := os.Open(p)
 	if err != nil {
-		return nil, checkError(err, nil)
+		return nil, CheckError(err, nil)
 	}
 	defer r.Close()
 	return OpenReader(r, area)
 }
 
 func OpenReader(r io.Reader, area Shape) (*Schedule, error) {
+	return OpenReaderContext(context.Background(), r, area)
+}
+
+func OpenReaderContext(ctx context.Context, r io.Reader, area Shape) (*Schedule, error) {
+	return OpenReaderProgress(ctx, r, area, nil)
+}
+
+const ProgressInterval = 1000
+
+// maxSpacings bounds the number of distinct intervals between two rows counted
+// to find the spacing of a trajectory.
+const maxSpacings = 16
+
+type Progress struct {
+	Rows     int
+	Eclipses int
+	Saas     int
+	Auroras  int
+	Done     bool
+}
+
+type ProgressFunc func(Progress)
+
+// TraceFunc is called with an entry moved by a scheduling rule and the time
+// of the entry before the rule was applied. It can be called concurrently
+// when ROC is scheduled by several workers.
+type TraceFunc func(e Entry, from time.Time, rule string)
+
+func (fn TraceFunc) trace(e Entry, from time.Time, rule string) {
+	if fn == nil || e.When.Equal(from) {
+		return
+	}
+	fn(e, from, rule)
+}
+
+// OpenReaderProgress is like OpenReaderContext but calls fn every
+// ProgressInterval rows read from r and once when the trajectory is fully read.
+func OpenReaderProgress(ctx context.Context, r io.Reader, area Shape, fn ProgressFunc) (*Schedule, error) {
+	return OpenReaderColumns(ctx, r, area, DefaultColumns, fn)
+}
+
+// Columns gives the (zero based) index of the eclipse and SAA columns of the
+// trajectory. A row enters a period when its column is 1, on or true and
+// leaves it when its column is 0, off or false.
+type Columns struct {
+	Eclipse int
+	Saa     int
+}
+
+var DefaultColumns = Columns{
+	Eclipse: PredictEclipseIndex,
+	Saa:     PredictSaaIndex,
+}
+
+// Check reports an error if the eclipse and SAA columns are the same or if
+// one of them is not a free column of the trajectory.
+func (c Columns) Check() error {
+	check := func(n string, i int) error {
+		switch {
+		case i < 0 || i >= PredictColumns:
+			return BadUsage(fmt.Sprintf("%s column out of range (%d)", n, i+1))
+		case i == PredictTimeIndex || i == PredictLatIndex || i == PredictLonIndex:
+			return BadUsage(fmt.Sprintf("%s column can not be the time or position column (%d)", n, i+1))
+		}
+		return nil
+	}
+	if err := check("eclipse", c.Eclipse); err != nil {
+		return err
+	}
+	if err := check("saa", c.Saa); err != nil {
+		return err
+	}
+	if c.Eclipse == c.Saa {
+		return BadUsage(fmt.Sprintf("eclipse and saa use the same column (%d)", c.Eclipse+1))
+	}
+	return nil
+}
+
+// OpenReaderColumns is like OpenReaderProgress but reads the eclipses and the
+// SAAs from the columns given by cols.
+func OpenReaderColumns(ctx context.Context, r io.Reader, area Shape, cols Columns, fn ProgressFunc) (*Schedule, error) {
+	if err := cols.Check(); err != nil {
+		return nil, err
+	}
 	var s Schedule
-	return &s, s.listPeriods(r, area)
+	return &s, s.listPeriods(ctx, r, area, cols, fn)
+}
+
+func (s *Schedule) progress(rows int, done bool) Progress {
+	return Progress{
+		Rows:     rows,
+		Eclipses: len(s.Eclipses),
+		Saas:     len(s.Saas),
+		Auroras:  len(s.Auroras),
+		Done:     done,
+	}
 }
 
 func (s *Schedule) Filter(t time.Time) *Schedule {
@@ -106,15 +264,100 @@ func (s *Schedule) Filter(t time.Time) *Schedule {
 			xs = append(xs, a)
 		}
 	}
-	c := Schedule{
-		Ignore:   s.Ignore,
-		Eclipses: es,
-		Saas:     as,
-		Auroras:  xs,
-	}
+	c := *s
+	c.Eclipses, c.Saas, c.Auroras = es, as, xs
 	return &c
 }
 
+func (s *Schedule) FilterRange(starts, ends time.Time) (*Schedule, []Period) {
+	c := s.Filter(starts)
+	if ends.IsZero() {
+		return c, nil
+	}
+	var cut []Period
+	clamp := func(ps []Period) []Period {
+		xs := make([]Period, 0, len(ps))
+		for _, p := range ps {
+			if !p.Starts.Before(ends) {
+				continue
+			}
+			if p.Ends.After(ends) {
+				cut = append(cut, p)
+				p.Ends = ends
+			}
+			xs = append(xs, p)
+		}
+		return xs
+	}
+	if c == s {
+		x := *s
+		c = &x
+	}
+	c.Eclipses = clamp(c.Eclipses)
+	c.Saas = clamp(c.Saas)
+	c.Auroras = clamp(c.Auroras)
+	return c, cut
+}
+
+// MergePeriods merges the consecutive periods of s with the same label (and
+// the same area for the auroras) separated by less than gap.
+func (s *Schedule) MergePeriods(gap time.Duration) {
+	s.Eclipses = mergePeriods(s.Eclipses, gap)
+	s.Saas = mergePeriods(s.Saas, gap)
+	s.Auroras = mergePeriods(s.Auroras, gap)
+}
+
+func mergePeriods(ps []Period, gap time.Duration) []Period {
+	if len(ps) <= 1 {
+		return ps
+	}
+	xs := make([]Period, 0, len(ps))
+	xs = append(xs, ps[0])
+	for _, p := range ps[1:] {
+		last := &xs[len(xs)-1]
+		if last.Label == p.Label && last.Area == p.Area && last.Gap(p) < gap {
+			*last = last.Union(p)
+			continue
+		}
+		xs = append(xs, p)
+	}
+	return xs
+}
+
+// Validate checks that the periods of s are consistent: eclipses sorted and
+// not overlapping, saas sorted, auroras inside an eclipse and no period with a
+// zero duration or ending before it starts. It returns the first violation
+// found.
+func (s *Schedule) Validate() error {
+	for _, ps := range [][]Period{s.Eclipses, s.Saas, s.Auroras} {
+		for i, p := range ps {
+			if p.Ends.Before(p.Starts) {
+				return invalidSchedule(p, "ends before it starts")
+			}
+			if p.Duration() == 0 {
+				return invalidSchedule(p, "zero duration")
+			}
+			if i > 0 && p.Starts.Before(ps[i-1].Starts) {
+				return invalidSchedule(p, "not sorted")
+			}
+		}
+	}
+	for i := 1; i < len(s.Eclipses); i++ {
+		if prev := s.Eclipses[i-1]; !s.Eclipses[i].Starts.After(prev.Ends) {
+			return invalidSchedule(s.Eclipses[i], "overlaps previous eclipse")
+		}
+	}
+	for _, a := range s.Auroras {
+		x := sort.Search(len(s.Eclipses), func(i int) bool {
+			return !s.Eclipses[i].Ends.Before(a.Ends)
+		})
+		if x >= len(s.Eclipses) || !s.Eclipses[x].Contains(a) {
+			return invalidSchedule(a, "outside of eclipse")
+		}
+	}
+	return nil
+}
+
 func (s *Schedule) Periods() []Period {
 	es := make([]Period, 0, len(s.Eclipses)+len(s.Saas)+len(s.Auroras))
 	es = append(es, s.Eclipses...)
@@ -125,65 +368,327 @@ func (s *Schedule) Periods() []Period {
 	return es
 }
 
+// Daylights returns the periods between two consecutive eclipses.
+func (s *Schedule) Daylights() []Period {
+	if len(s.Eclipses) < 2 {
+		return nil
+	}
+	ps := make([]Period, 0, len(s.Eclipses)-1)
+	for i := 1; i < len(s.Eclipses); i++ {
+		ps = append(ps, Period{
+			Label:  "daylight",
+			Starts: s.Eclipses[i-1].Ends,
+			Ends:   s.Eclipses[i].Starts,
+		})
+	}
+	return ps
+}
+
 func (s *Schedule) Schedule(roc RocOption, cer CerOption, aur AuroraOption) ([]Entry, error) {
-	rs, err := s.ScheduleROC(roc)
+	return s.ScheduleContext(context.Background(), roc, cer, aur)
+}
+
+func (s *Schedule) ScheduleContext(ctx context.Context, roc RocOption, cer CerOption, aur AuroraOption) ([]Entry, error) {
+	s.dropped = s.dropped[:0]
+	s.skipped = s.skipped[:0]
+	rs, err := s.runROC(ctx, roc)
 	if err != nil {
 		return nil, err
 	}
-	as, err := s.ScheduleCER(cer, roc, rs)
+	as, err := s.runCER(ctx, cer, roc, rs)
 	if err != nil {
 		return nil, err
 	}
-	cs, err := s.ScheduleACS(aur, roc, rs)
+	cs, err := s.runACS(ctx, aur, roc, rs)
 	if err != nil {
 		return nil, err
-	} else {
 	}
 	es := append([]Entry{}, rs...)
 	es = append(es, as...)
 	es = append(es, cs...)
+	for _, i := range s.Instruments {
+		if err := i.CheckName(); err != nil {
+			return nil, err
+		}
+		xs, err := s.runInstrument(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, xs...)
+	}
 	sort.Slice(es, func(i, j int) bool { return es[i].When.Before(es[j].When) })
-	return es, nil
+	es = s.checkBlackouts(es, roc, cer, aur)
+	return s.checkGap(es, roc, cer, aur), nil
+}
+
+// checkBlackouts drops or flags the blocks overlapping a blackout. A block is
+// an ON command with the commands until its OFF command: it is affected as a
+// whole, from the start of its ON command until the end of its OFF command.
+func (s *Schedule) checkBlackouts(es []Entry, roc RocOption, cer CerOption, aur AuroraOption) []Entry {
+	if len(s.Blackouts) == 0 {
+		return es
+	}
+	drop := make([]bool, len(es))
+	for _, g := range pairEntries(es, s.Instruments...) {
+		w := blockSpan(es, g, roc, cer, aur, s.Instruments...)
+		for _, b := range s.Blackouts {
+			if !b.Overlaps(w) {
+				continue
+			}
+			if !s.keepConflict() {
+				s.drop(w.Label, ConflictBlackout, w)
+			}
+			for _, i := range g {
+				if s.keepConflict() {
+					es[i].Flag(ConflictBlackout)
+					continue
+				}
+				drop[i] = true
+			}
+			break
+		}
+	}
+	xs := es[:0]
+	for i, e := range es {
+		if !drop[i] {
+			xs = append(xs, e)
+		}
+	}
+	return xs
+}
+
+// checkGap flags the blocks starting less than MinGap after the end of any
+// previous block. A block is an ON command with the commands until its OFF
+// command. With Ignore, a flagged block is also moved at the end of the gap,
+// keeping the offsets between its commands, when it still ends within its
+// period and before the next block of the same instrument.
+func (s *Schedule) checkGap(es []Entry, roc RocOption, cer CerOption, aur AuroraOption) []Entry {
+	if s.MinGap <= 0 || len(es) == 0 {
+		return es
+	}
+	if s.gapBlocks(es, roc, cer, aur, s.Ignore) {
+		sort.SliceStable(es, func(i, j int) bool { return es[i].When.Before(es[j].When) })
+		// the order of the blocks could have changed: check the gaps again
+		// without moving anything
+		s.gapBlocks(es, roc, cer, aur, false)
+	}
+	return es
+}
+
+// gapBlocks flags the blocks of es too close to a previous block and moves
+// them when shift is set. It reports whether a block has been moved.
+func (s *Schedule) gapBlocks(es []Entry, roc RocOption, cer CerOption, aur AuroraOption, shift bool) bool {
+	var (
+		gs      = pairEntries(es, s.Instruments...)
+		ends    time.Time
+		last    int
+		shifted bool
+	)
+	for k, g := range gs {
+		w := blockSpan(es, g, roc, cer, aur, s.Instruments...)
+		if k > 0 && w.Starts.Sub(ends) < s.MinGap {
+			for _, i := range gs[last] {
+				es[i].Flag(ConflictMinGap)
+			}
+			for _, i := range g {
+				es[i].Flag(ConflictMinGap)
+			}
+			if delta := ends.Add(s.MinGap).Sub(w.Starts); shift && s.canShift(es, gs, k, delta, w) {
+				for _, i := range g {
+					es[i].When = es[i].When.Add(delta)
+				}
+				w.Starts, w.Ends = w.Starts.Add(delta), w.Ends.Add(delta)
+				shifted = true
+			}
+		}
+		if k == 0 || w.Ends.After(ends) {
+			ends, last = w.Ends, k
+		}
+	}
+	return shifted
+}
+
+// canShift tells if the block gs[k] of es, spanning w, can be moved by delta:
+// all its commands have to stay within their period and the block has to end
+// before the next block of the same instrument.
+func (s *Schedule) canShift(es []Entry, gs [][]int, k int, delta time.Duration, w Period) bool {
+	for _, i := range gs[k] {
+		if es[i].Period.IsZero() || es[i].When.Add(delta).After(es[i].Period.Ends) {
+			return false
+		}
+	}
+	if w.Ends.Add(delta).After(es[gs[k][len(gs[k])-1]].Period.Ends) {
+		return false
+	}
+	instr := Instrument(es[gs[k][0]].Label, s.Instruments...)
+	if instr == "" {
+		return true
+	}
+	for _, g := range gs[k+1:] {
+		if Instrument(es[g[0]].Label, s.Instruments...) == instr {
+			return w.Ends.Add(delta).Before(es[g[0]].When)
+		}
+	}
+	return true
+}
+
+// EntryDuration gives the execution time of e. The instruments is are used
+// for the labels not belonging to ROC, CER and ACS.
+func EntryDuration(e Entry, roc RocOption, cer CerOption, aur AuroraOption, is ...InstrumentOption) time.Duration {
+	switch e.Label {
+	case ROCON:
+		return roc.TimeOn.Duration
+	case ROCOFF:
+		return roc.TimeOff.Duration
+	case CERON:
+		return cer.TimeOn.Duration
+	case CEROFF:
+		return cer.TimeOff.Duration
+	case ACSON, ACSOFF:
+		return aur.For(e.Period).Time.Duration
+	default:
+		i, ok := lookupInstrument(e.Label, is)
+		if !ok {
+			return 0
+		}
+		if on, _ := i.Labels(); e.Label == on {
+			return i.TimeOn.Duration
+		}
+		return i.TimeOff.Duration
+	}
 }
 
 func (s *Schedule) ScheduleROC(roc RocOption) ([]Entry, error) {
+	return s.runROC(context.Background(), roc)
+}
+
+func (s *Schedule) runROC(ctx context.Context, roc RocOption) ([]Entry, error) {
 	if roc.IsEmpty() {
 		return nil, nil
 	}
-	return s.scheduleROC(roc)
+	es, err := s.scheduleROC(ctx, roc)
+	if err != nil || roc.MaxPerDay <= 0 {
+		return es, err
+	}
+	return s.limitROC(es, roc), nil
+}
+
+func (s *Schedule) limitROC(es []Entry, roc RocOption) []Entry {
+	var (
+		window = roc.MaxWindow.Duration
+		origin = s.Origin
+	)
+	if window <= 0 {
+		// UTC days
+		window, origin = Day, time.Time{}
+	}
+	var (
+		groups = make(map[time.Time][]int)
+		keys   []time.Time
+	)
+	for i := 0; i+1 < len(es); i += 2 {
+		k := es[i].When.Truncate(window)
+		if !origin.IsZero() {
+			d := es[i].When.Sub(origin)
+			if d %= window; d < 0 {
+				d += window
+			}
+			k = es[i].When.Add(-d)
+		}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+	skip := make(map[int]bool)
+	for _, k := range keys {
+		is := groups[k]
+		if len(is) <= roc.MaxPerDay {
+			continue
+		}
+		if roc.MaxRule == RuleLongest {
+			sort.SliceStable(is, func(i, j int) bool {
+				return es[is[i]].Period.Duration() > es[is[j]].Period.Duration()
+			})
+		}
+		for _, i := range is[roc.MaxPerDay:] {
+			skip[i] = true
+			s.drop(ROCON, ConflictRocLimit, es[i].Period)
+		}
+	}
+	xs := make([]Entry, 0, len(es))
+	for i := 0; i+1 < len(es); i += 2 {
+		if skip[i] {
+			continue
+		}
+		xs = append(xs, es[i], es[i+1])
+	}
+	return xs
 }
 
 func (s *Schedule) ScheduleCER(cer CerOption, roc RocOption, rs []Entry) ([]Entry, error) {
+	return s.runCER(context.Background(), cer, roc, rs)
+}
+
+func (s *Schedule) runCER(ctx context.Context, cer CerOption, roc RocOption, rs []Entry) ([]Entry, error) {
 	if cer.IsEmpty() {
 		return nil, nil
 	}
-	if cer.SwitchTime.IsZero() {
+	// overlapping SAA are always merged, the ones separated by less than
+	// saa-merge-gap too
+	saas := mergePeriods(s.Saas, cer.MergeGap.Duration)
+	inside := cer.SwitchTime.IsZero()
+	switch cer.Algorithm {
+	case CerSaa:
+		return s.scheduleSaaCER(ctx, cer, saas)
+	case CerInside:
+		inside = true
+	case CerClassic:
+		inside = false
+	}
+	if inside {
 		if len(rs) == 0 {
-			return nil, fmt.Errorf("CER: can not schedule without ROC")
+			return nil, genericErr("CER: can not schedule without ROC")
 		}
-		return s.scheduleInsideCER(cer, roc, rs)
+		return s.scheduleInsideCER(ctx, cer, roc, rs, saas)
 	}
-	return s.scheduleOutsideCER(cer)
+	return s.scheduleOutsideCER(ctx, cer, saas)
 }
 
 func (s *Schedule) ScheduleACS(aur AuroraOption, roc RocOption, rs []Entry) ([]Entry, error) {
+	return s.runACS(context.Background(), aur, roc, rs)
+}
+
+func (s *Schedule) runACS(ctx context.Context, aur AuroraOption, roc RocOption, rs []Entry) ([]Entry, error) {
 	if aur.IsEmpty() {
 		return nil, nil
 	}
 	var es []Entry
-	if len(rs) == 0 {
-		return nil, fmt.Errorf("ACS: can not schedule without ROC")
+	if len(rs) == 0 && !aur.WithoutRoc {
+		return nil, genericErr("ACS: can not schedule without ROC (see without-roc)")
 	}
 	for _, p := range s.Auroras {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		aur := aur.For(p)
 		if !aur.Accept(p) {
+			s.skipped = append(s.skipped, Drop{Label: ACSON, Reason: SkipTooShort, Period: p})
 			continue
 		}
-		on := s.scheduleACSON(p, rs, aur, roc)
+		on, reason := s.scheduleACSON(p, rs, aur, roc)
 		if on.IsZero() {
+			s.drop(ACSON, reason, p)
+			if !aur.ForceOff {
+				continue
+			}
+			if off := s.scheduleACSOFF(p, rs, aur, roc); !off.IsZero() {
+				es = append(es, off)
+			}
 			continue
 		}
 		es = append(es, on)
-		off := s.scheduleACSOFF(p, aur, roc)
+		off := s.scheduleACSOFF(p, rs, aur, roc)
 		if !off.IsZero() && off.When.After(on.When.Add(aur.Time.Duration)) {
 			es = append(es, off)
 		}
@@ -191,7 +696,7 @@ func (s *Schedule) ScheduleACS(aur AuroraOption, roc RocOption, rs []Entry) ([]E
 	return es, nil
 }
 
-func (s *Schedule) scheduleACSOFF(p Period, aur AuroraOption, roc RocOption) Entry {
+func (s *Schedule) scheduleACSOFF(p Period, rs []Entry, aur AuroraOption, roc RocOption) Entry {
 	other := isCrossing(p, s.Eclipses, func(curr, other Period) bool {
 		return !other.Ends.Before(curr.Ends.Add(-aur.Time.Duration))
 	})
@@ -199,7 +704,8 @@ func (s *Schedule) scheduleACSOFF(p Period, aur AuroraOption, roc RocOption) Ent
 		Label:  ACSOFF,
 		Period: p,
 	}
-	if other.IsZero() {
+	// without ROC, there is no ROCOFF to schedule ACSOFF before
+	if other.IsZero() || len(rs) == 0 {
 		e.When = p.Ends.Add(-aur.Time.Duration)
 		return e
 	}
@@ -212,12 +718,14 @@ func (s *Schedule) scheduleACSOFF(p Period, aur AuroraOption, roc RocOption) Ent
 		e.When = acsoff
 	case p.Ends.Add(-aur.Time.Duration).Equal(other.Ends.Add(-roc.TimeOff.Duration)):
 		e.When = rocoff.Add(-aur.Time.Duration)
+		s.Trace.trace(e, acsoff, "ACSOFF moved before ROCOFF")
 	default:
+		s.Trace.trace(e, acsoff, "ACSOFF not scheduled: after ROCOFF")
 	}
 	return e
 }
 
-func (s *Schedule) scheduleACSON(p Period, rs []Entry, aur AuroraOption, roc RocOption) Entry {
+func (s *Schedule) scheduleACSON(p Period, rs []Entry, aur AuroraOption, roc RocOption) (Entry, string) {
 	var (
 		starts = p.Starts.Add(-roc.TimeOn.Duration)
 		ends   = p.Starts.Add(roc.WaitBeforeOn.Duration + roc.TimeOn.Duration) // .Add(roc.TimeOn.Duration+time.Second)
@@ -241,9 +749,10 @@ func (s *Schedule) scheduleACSON(p Period, rs []Entry, aur AuroraOption, roc Roc
 		when := rocon.When.Add(roc.TimeOn.Duration)
 		// when := rocon.When.Add(roc.TimeOn.Duration + roc.WaitBeforeOn.Duration)
 		if when.After(p.Ends) {
-			return e
+			return e, ConflictAcsRocon
 		}
 		e.When = when
+		s.Trace.trace(e, p.Starts, "ACSON moved after ROCON")
 	}
 	rocoff := isNear(p, rs, func(x Entry) bool {
 		if x.Label != ROCOFF {
@@ -255,17 +764,20 @@ func (s *Schedule) scheduleACSON(p Period, rs []Entry, aur AuroraOption, roc Roc
 		return e.When.After(x.When) && e.When.Before(x.When.Add(roc.TimeOff.Duration))
 	})
 	if !rocoff.IsZero() {
-		return Entry{Label: ACSON}
+		return Entry{Label: ACSON, Period: p}, ConflictAcsRocoff
 	}
-	return e
+	return e, ""
 }
 
-func (s *Schedule) scheduleInsideCER(cer CerOption, roc RocOption, rs []Entry) ([]Entry, error) {
+func (s *Schedule) scheduleInsideCER(ctx context.Context, cer CerOption, roc RocOption, rs []Entry, saas []Period) ([]Entry, error) {
 	predicate := func(e, a Period) bool { return e.Overlaps(a) }
 
 	var es []Entry
 	for _, e := range s.Eclipses {
-		as := isCrossingList(e, s.Saas, predicate)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		as := isCrossingList(e, overlapping(e, saas), predicate)
 
 		var p Period
 		switch len(as) {
@@ -274,10 +786,10 @@ func (s *Schedule) scheduleInsideCER(cer CerOption, roc RocOption, rs []Entry) (
 		case 1:
 			p = as[0]
 		default:
-			f, t := as[0], as[len(as)-1]
-			p = Period{
-				Starts: f.Starts,
-				Ends:   t.Ends,
+			if cer.Crossing == "" {
+				p = as[0].Union(as[len(as)-1])
+			} else {
+				p, _ = selectCrossing(e, as, cer.Crossing)
 			}
 		}
 		if p.Duration() < cer.SaaCrossingTime.Duration || e.Intersect(p) < cer.SaaCrossingTime.Duration {
@@ -298,7 +810,9 @@ func (s *Schedule) scheduleInsideCER(cer CerOption, roc RocOption, rs []Entry) (
 				dr = roc.TimeOn.Duration
 			}
 			if isBetween(r.When, r.When.Add(dr), cn.When) || isBetween(r.When, r.When.Add(dr), cn.When.Add(cer.TimeOn.Duration)) {
+				from := cn.When
 				cn.When = r.When.Add(-cer.BeforeRoc.Duration)
+				s.Trace.trace(cn, from, "CERON moved before "+r.Label)
 			}
 		}
 		cf := Entry{
@@ -317,15 +831,75 @@ func (s *Schedule) scheduleInsideCER(cer CerOption, roc RocOption, rs []Entry) (
 				dr = roc.TimeOn.Duration
 			}
 			if isBetween(r.When, r.When.Add(dr), cf.When) || isBetween(r.When, r.When.Add(dr), cf.When.Add(cer.TimeOff.Duration)) {
+				from := cf.When
 				cf.When = r.When.Add(dr + cer.AfterRoc.Duration)
+				s.Trace.trace(cf, from, "CEROFF moved after "+r.Label)
+			}
+		}
+		if !cf.When.After(cn.When) {
+			if !s.keepConflict() {
+				s.drop(CERON, ConflictCerOrder, p)
+				continue
+			}
+			cn.Flag(ConflictCerOrder)
+			cf.Flag(ConflictCerOrder)
+		}
+		if !cer.MinOn.IsZero() && cf.When.Sub(cn.When) < cer.MinOn.Duration {
+			if !s.keepConflict() {
+				s.drop(CERON, ConflictCerMinOn, p)
+				continue
+			}
+			cn.Flag(ConflictCerMinOn)
+			cf.Flag(ConflictCerMinOn)
+		}
+		es = append(es, cn, cf)
+	}
+	return es, nil
+}
+
+// scheduleSaaCER schedules CERON before entering and CEROFF after leaving each
+// SAA, whether it crosses an eclipse or not. CER stays on between two SAA when
+// the CEROFF of the first is not before the CERON of the second.
+func (s *Schedule) scheduleSaaCER(ctx context.Context, cer CerOption, saas []Period) ([]Entry, error) {
+	var es []Entry
+	for _, p := range saas {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var (
+			cn = Entry{
+				Label:  CERON,
+				When:   p.Starts.Add(-cer.BeforeSaa.Duration),
+				Period: p,
+			}
+			cf = Entry{
+				Label:  CEROFF,
+				When:   p.Ends.Add(cer.AfterSaa.Duration),
+				Period: p,
 			}
+		)
+		if n := len(es); n > 0 && !cn.When.After(es[n-1].When.Add(cer.TimeOff.Duration)) {
+			es[n-1] = cf
+			continue
+		}
+		if !cer.MinOn.IsZero() && cf.When.Sub(cn.When) < cer.MinOn.Duration {
+			if !s.keepConflict() {
+				s.drop(CERON, ConflictCerMinOn, p)
+				continue
+			}
+			cn.Flag(ConflictCerMinOn)
+			cf.Flag(ConflictCerMinOn)
 		}
 		es = append(es, cn, cf)
 	}
 	return es, nil
 }
 
-func (s *Schedule) scheduleOutsideCER(cer CerOption) ([]Entry, error) {
+// scheduleOutsideCER implements the classic CER algorithm: a CERON is scheduled
+// before the first eclipse crossing a SAA after eclipses without crossing and a
+// CEROFF before the first eclipse without crossing after crossing ones.
+// cer.SwitchTime is not used here, only cer.TimeOn and cer.TimeOff.
+func (s *Schedule) scheduleOutsideCER(ctx context.Context, cer CerOption, saas []Period) ([]Entry, error) {
 	eclipses := make([]Period, len(s.Eclipses))
 	copy(eclipses, s.Eclipses)
 
@@ -337,8 +911,15 @@ func (s *Schedule) scheduleOutsideCER(cer CerOption) ([]Entry, error) {
 		return cer.SaaCrossingTime.IsZero() || e.Intersect(a) > cer.SaaCrossingTime.Duration
 	}
 	for len(eclipses) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		e := eclipses[0]
-		if a := isCrossing(e, s.Saas, predicate); !a.IsZero() {
+		as := saas
+		if !cer.SaaCrossingTime.IsZero() {
+			as = overlapping(e, as)
+		}
+		if a := isCrossing(e, as, predicate); !a.IsZero() {
 			crossing = true
 			es = append(es, Entry{
 				Label: CERON,
@@ -352,50 +933,175 @@ func (s *Schedule) scheduleOutsideCER(cer CerOption) ([]Entry, error) {
 				Period: e,
 			})
 		}
-		eclipses = skipEclipses(eclipses[1:], s.Saas, crossing, cer.SaaCrossingTime.Duration)
+		eclipses = skipEclipses(eclipses[1:], saas, crossing, cer.SaaCrossingTime.Duration)
 	}
 	return es, nil
 }
 
-func (s *Schedule) scheduleROC(roc RocOption) ([]Entry, error) {
+type rocBlock struct {
+	On, Off Entry
+	Dropped string
+}
+
+func (s *Schedule) scheduleROC(ctx context.Context, roc RocOption) ([]Entry, error) {
+	ps := s.Eclipses
+	if roc.Daylight {
+		ps = s.Daylights()
+	}
 	var (
-		es        []Entry
-		predicate = func(e, a Period) bool { return e.Overlaps(a) }
+		bs  = make([]rocBlock, len(ps))
+		err error
 	)
-
-	for _, e := range s.Eclipses {
-		as := isCrossingList(e, s.Saas, predicate)
-		var s1, s2 Period
-		switch z := len(as); {
-		case z == 0:
-		case z == 1:
-			s1, s2 = as[0], as[0]
-		default:
-			s1, s2 = as[0], as[z-1]
+	if s.Workers > 1 {
+		err = s.scheduleROCParallel(ctx, roc, ps, bs)
+	} else {
+		for i, e := range ps {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			bs[i] = s.scheduleBlock(e, roc)
 		}
-		var (
-			rocon  = scheduleROCON(e, s1, roc)
-			rocoff = scheduleROCOFF(e, s2, roc)
-		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	es := make([]Entry, 0, 2*len(bs))
+	for i, b := range bs {
+		if b.Dropped != "" {
+			s.drop(ROCON, b.Dropped, ps[i])
+			continue
+		}
+		es = append(es, b.On, b.Off)
+	}
+	return es, nil
+}
 
-		if !roc.TimeBetween.IsZero() && rocoff.When.Sub(rocon.When.Add(roc.TimeOn.Duration)) <= roc.TimeBetween.Duration {
-			if !s.Ignore {
-				continue
+func (s *Schedule) scheduleROCParallel(ctx context.Context, roc RocOption, ps []Period, bs []rocBlock) error {
+	var (
+		queue = make(chan int)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < s.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				bs[i] = s.scheduleBlock(ps[i], roc)
 			}
-			rocon.Warning, rocoff.Warning = true, true
+		}()
+	}
+	var err error
+	for i := range ps {
+		if err = ctx.Err(); err != nil {
+			break
 		}
-		if rocoff.When.Before(rocon.When) || rocoff.When.Sub(rocon.When) <= roc.TimeOn.Duration {
-			if !s.Ignore {
-				continue
-			}
-			rocon.Warning, rocoff.Warning = true, true
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return err
+}
+
+func (s *Schedule) scheduleBlock(e Period, roc RocOption) rocBlock {
+	var (
+		predicate = func(e, a Period) bool { return e.Overlaps(a) }
+		as        = isCrossingList(e, overlapping(e, s.Saas), predicate)
+		s1, s2    = selectCrossing(e, as, roc.Crossing)
+		rocon     = scheduleROCON(e, s1, roc, s.Trace)
+		rocoff    = scheduleROCOFF(e, s2, roc, s.Trace)
+	)
+	if s.Conflict == ConflictShift && !(roc.hasMargin(rocon, rocoff) && roc.hasOrder(rocon, rocoff)) {
+		on, off := shiftROC(e, s1, s2, rocon, rocoff, roc)
+		s.Trace.trace(on, rocon.When, "ROCON shifted to respect the margin")
+		s.Trace.trace(off, rocoff.When, "ROCOFF shifted to respect the margin")
+		rocon, rocoff = on, off
+	}
+	if !roc.hasMargin(rocon, rocoff) {
+		if !s.keepConflict() {
+			return rocBlock{Dropped: ConflictRocMargin}
 		}
-		es = append(es, rocon, rocoff)
+		rocon.Flag(ConflictRocMargin)
+		rocoff.Flag(ConflictRocMargin)
 	}
-	return es, nil
+	if !roc.hasOrder(rocon, rocoff) {
+		if !s.keepConflict() {
+			return rocBlock{Dropped: ConflictRocOrder}
+		}
+		rocon.Flag(ConflictRocOrder)
+		rocoff.Flag(ConflictRocOrder)
+	}
+	return rocBlock{On: rocon, Off: rocoff}
 }
 
-func scheduleROCON(e, s Period, roc RocOption) Entry {
+func (s *Schedule) drop(label, reason string, p Period) {
+	s.dropped = append(s.dropped, Drop{
+		Label:  label,
+		Reason: reason,
+		Period: p,
+	})
+}
+
+func (s *Schedule) keepConflict() bool {
+	switch s.Conflict {
+	case ConflictIgnore:
+		return true
+	case ConflictDrop:
+		return false
+	default:
+		return s.Ignore
+	}
+}
+
+// shiftROC tries to move ROCOFF later, then ROCON earlier, in order to
+// respect the margin between ROCON end and ROCOFF start without leaving
+// the eclipse nor moving a command in the AZM of the SAA s1 and s2. When no
+// such move exists, rocon and rocoff are returned unchanged.
+func shiftROC(e, s1, s2 Period, rocon, rocoff Entry, roc RocOption) (Entry, Entry) {
+	need := roc.TimeOn.Duration + roc.TimeBetween.Duration + time.Second
+	if rocoff.When.Sub(rocon.When) >= need {
+		return rocon, rocoff
+	}
+	valid := func(on, off Entry) bool {
+		switch {
+		case off.When.Sub(on.When) < need:
+			return false
+		case on.When.Before(e.Starts) || off.When.Add(roc.TimeOff.Duration).After(e.Ends):
+			return false
+		case !on.When.Equal(rocon.When) && roc.inAZM(on.When, roc.TimeOn.Duration, s1, s2):
+			return false
+		case !off.When.Equal(rocoff.When) && roc.inAZM(off.When, roc.TimeOff.Duration, s1, s2):
+			return false
+		default:
+			return true
+		}
+	}
+	var (
+		last = e.Ends.Add(-roc.TimeOff.Duration)
+		on   = rocon
+		off  = rocoff
+	)
+	// ROCOFF later, then ROCON earlier if ROCOFF can not move far enough
+	if off.When = rocon.When.Add(need); off.When.After(last) {
+		off.When = last
+	}
+	if off.When.Before(rocoff.When) {
+		off.When = rocoff.When
+	}
+	if valid(on, off) {
+		return on, off
+	}
+	if on.When = off.When.Add(-need); valid(on, off) {
+		return on, off
+	}
+	// ROCON earlier only
+	on, off = rocon, rocoff
+	if on.When = rocoff.When.Add(-need); valid(on, off) {
+		return on, off
+	}
+	return rocon, rocoff
+}
+
+func scheduleROCON(e, s Period, roc RocOption, trace TraceFunc) Entry {
 	y := Entry{
 		Label:  ROCON,
 		When:   e.Starts.Add(roc.WaitBeforeOn.Duration),
@@ -404,33 +1110,50 @@ func scheduleROCON(e, s Period, roc RocOption) Entry {
 	if s.IsZero() {
 		return y
 	}
+	from := y.When
+	if roc.Anchor == AnchorSaa {
+		if when := s.Starts.Add(roc.WaitBeforeOn.Duration); when.After(e.Starts) {
+			y.When = when
+			trace.trace(y, from, "ROCON anchored to SAA enter")
+		}
+	}
 	if !roc.TimeSAA.IsZero() && s.Duration() <= roc.TimeSAA.Duration {
-		enter, exit := s.Starts, s.Starts.Add(2*roc.TimeAZM.Duration)
+		enter, exit := s.Starts, s.Starts.Add(roc.EnterAZM()+roc.ExitAZM())
 		if isBetween(enter, exit, y.When) || isBetween(enter, exit, y.When.Add(roc.TimeOn.Duration)) {
+			from = y.When
 			y.When = exit
+			trace.trace(y, from, "ROCON shifted after short SAA AZM")
 		}
 		return y
 	}
 	// check that ROCON does not completly overlap AZM of SAA enter
 	// then check that ROCON does not start within the AZM of the SAA enter
-	if y.When.Before(s.Starts) && y.When.Add(roc.TimeOn.Duration).After(s.Starts.Add(roc.TimeAZM.Duration)) {
-		y.When = s.Starts.Add(roc.TimeAZM.Duration)
+	if y.When.Before(s.Starts) && y.When.Add(roc.TimeOn.Duration).After(s.Starts.Add(roc.EnterAZM())) {
+		from = y.When
+		y.When = s.Starts.Add(roc.EnterAZM())
+		trace.trace(y, from, "ROCON overlaps SAA enter AZM, shifted to its end")
 	}
-	if isBetween(s.Starts, s.Starts.Add(roc.TimeAZM.Duration), y.When) || isBetween(s.Starts, s.Starts.Add(roc.TimeAZM.Duration), y.When.Add(roc.TimeOn.Duration)) {
-		y.When = s.Starts.Add(roc.TimeAZM.Duration)
+	if isBetween(s.Starts, s.Starts.Add(roc.EnterAZM()), y.When) || isBetween(s.Starts, s.Starts.Add(roc.EnterAZM()), y.When.Add(roc.TimeOn.Duration)) {
+		from = y.When
+		y.When = s.Starts.Add(roc.EnterAZM())
+		trace.trace(y, from, "ROCON within SAA enter AZM, shifted to its end")
 	}
 	// check that ROCON does not completly overlap AZM of SAA exit
 	// then check that ROCON does not start within the AZM of the SAA exit
-	if y.When.Before(s.Ends) && y.When.Add(roc.TimeOn.Duration).After(s.Ends.Add(roc.TimeAZM.Duration)) {
-		y.When = s.Ends.Add(roc.TimeAZM.Duration)
+	if y.When.Before(s.Ends) && y.When.Add(roc.TimeOn.Duration).After(s.Ends.Add(roc.ExitAZM())) {
+		from = y.When
+		y.When = s.Ends.Add(roc.ExitAZM())
+		trace.trace(y, from, "ROCON overlaps SAA exit AZM, shifted to its end")
 	}
-	if isBetween(s.Ends, s.Ends.Add(roc.TimeAZM.Duration), y.When) || isBetween(s.Ends, s.Ends.Add(roc.TimeAZM.Duration), y.When.Add(roc.TimeOn.Duration-time.Second)) {
-		y.When = s.Ends.Add(roc.TimeAZM.Duration)
+	if isBetween(s.Ends, s.Ends.Add(roc.ExitAZM()), y.When) || isBetween(s.Ends, s.Ends.Add(roc.ExitAZM()), y.When.Add(roc.TimeOn.Duration-time.Second)) {
+		from = y.When
+		y.When = s.Ends.Add(roc.ExitAZM())
+		trace.trace(y, from, "ROCON within SAA exit AZM, shifted to its end")
 	}
 	return y
 }
 
-func scheduleROCOFF(e, s Period, roc RocOption) Entry {
+func scheduleROCOFF(e, s Period, roc RocOption, trace TraceFunc) Entry {
 	y := Entry{
 		Label:  ROCOFF,
 		When:   e.Ends.Add(-roc.TimeOff.Duration),
@@ -439,41 +1162,77 @@ func scheduleROCOFF(e, s Period, roc RocOption) Entry {
 	if s.IsZero() {
 		return y
 	}
+	from := y.When
 	if roc.TimeSAA.Duration > 0 && s.Duration() <= roc.TimeSAA.Duration {
-		enter, exit := s.Starts, s.Starts.Add(2*roc.TimeAZM.Duration)
+		enter, exit := s.Starts, s.Starts.Add(roc.EnterAZM()+roc.ExitAZM())
 		if isBetween(enter, exit, y.When) || isBetween(enter, exit, y.When.Add(roc.TimeOff.Duration)) {
 			y.When = enter.Add(-roc.TimeOff.Duration)
+			trace.trace(y, from, "ROCOFF shifted before short SAA AZM")
 		}
 		return y
 	}
 	// check that ROCOFF does not completly overlap AZM of SAA exit
 	// then check that ROCOFF does not start within the AZM of the SAA exit
-	if y.When.Before(s.Ends) && y.When.Add(roc.TimeOff.Duration).After(s.Ends.Add(roc.TimeAZM.Duration)) {
-		y.When = s.Ends.Add(roc.TimeAZM.Duration)
+	if y.When.Before(s.Ends) && y.When.Add(roc.TimeOff.Duration).After(s.Ends.Add(roc.ExitAZM())) {
+		from = y.When
+		y.When = s.Ends.Add(roc.ExitAZM())
+		trace.trace(y, from, "ROCOFF overlaps SAA exit AZM, shifted to its end")
 	}
-	if isBetween(s.Ends, s.Ends.Add(roc.TimeAZM.Duration), y.When) || isBetween(s.Ends, s.Ends.Add(roc.TimeAZM.Duration), y.When.Add(roc.TimeOff.Duration)) {
+	if isBetween(s.Ends, s.Ends.Add(roc.ExitAZM()), y.When) || isBetween(s.Ends, s.Ends.Add(roc.ExitAZM()), y.When.Add(roc.TimeOff.Duration)) {
+		from = y.When
 		y.When = s.Ends.Add(-roc.TimeOff.Duration)
+		trace.trace(y, from, "ROCOFF within SAA exit AZM, shifted before SAA exit")
 	}
 	// check that ROCON does not completly overlap AZM of SAA enter
 	// then check that ROCON does not start within the AZM of the SAA enter
-	if y.When.Before(s.Starts) && y.When.Add(roc.TimeOff.Duration).After(s.Starts.Add(roc.TimeAZM.Duration)) {
+	if y.When.Before(s.Starts) && y.When.Add(roc.TimeOff.Duration).After(s.Starts.Add(roc.EnterAZM())) {
+		from = y.When
 		y.When = s.Starts.Add(-roc.TimeOff.Duration)
+		trace.trace(y, from, "ROCOFF overlaps SAA enter AZM, shifted before SAA enter")
 	}
-	if isBetween(s.Starts, s.Starts.Add(roc.TimeAZM.Duration-time.Second), y.When) || isBetween(s.Starts, s.Starts.Add(roc.TimeAZM.Duration), y.When.Add(roc.TimeOff.Duration)) {
+	if isBetween(s.Starts, s.Starts.Add(roc.EnterAZM()-time.Second), y.When) || isBetween(s.Starts, s.Starts.Add(roc.EnterAZM()), y.When.Add(roc.TimeOff.Duration)) {
+		from = y.When
 		y.When = s.Starts.Add(-roc.TimeOff.Duration)
+		trace.trace(y, from, "ROCOFF within SAA enter AZM, shifted before SAA enter")
 	}
 	return y
 }
 
+func selectCrossing(e Period, as []Period, rule string) (Period, Period) {
+	if len(as) == 0 {
+		return Period{}, Period{}
+	}
+	var (
+		first = as[0]
+		last  = as[len(as)-1]
+	)
+	switch rule {
+	case CrossingFirst:
+		return first, first
+	case CrossingLast:
+		return last, last
+	case CrossingLongest:
+		p := first
+		for _, a := range as[1:] {
+			if e.Intersect(a) > e.Intersect(p) {
+				p = a
+			}
+		}
+		return p, p
+	default:
+		return first, last
+	}
+}
+
 func isBetween(f, t, d time.Time) bool {
 	return f.Before(t) && (f.Equal(d) || t.Equal(d) || f.Before(d) && t.After(d))
 }
 
-func (s *Schedule) listPeriods(r io.Reader, area Shape) error {
+func (s *Schedule) listPeriods(ctx context.Context, r io.Reader, area Shape, cols Columns, fn ProgressFunc) error {
 	rs := csv.NewReader(r)
 	rs.Comment = PredictComment
 	rs.Comma = PredictComma
-	rs.FieldsPerRecord = PredictColumns
+	rs.FieldsPerRecord = -1
 
 	// if r, err := rs.Read(); r == nil && err != nil {
 	// 	return err
@@ -482,42 +1241,70 @@ func (s *Schedule) listPeriods(r io.Reader, area Shape) error {
 	var (
 		e, a, x, z Period
 		last       time.Time
+		spacings   = make(map[time.Duration]int)
+		blank      = -1
 	)
 	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fn != nil && i > 0 && i%ProgressInterval == 0 {
+			fn(s.progress(i, false))
+		}
 		r, err := rs.Read()
 		if r == nil && err == io.EOF {
+			if fn != nil {
+				fn(s.progress(i, true))
+			}
 			break
 		}
 		if err != nil {
-			return badUsage(err.Error())
+			return BadUsage(err.Error())
+		}
+		// blank lines are only accepted at the end of the trajectory
+		if len(r) == 1 && strings.TrimSpace(r[0]) == "" {
+			if blank < 0 {
+				blank = i
+			}
+			continue
+		}
+		if blank >= 0 {
+			return columnsBadCount(blank, 1)
+		}
+		if len(r) != PredictColumns {
+			return columnsBadCount(i, len(r))
 		}
 		lat, lng, err := parseLatLng(r, i)
 		if err != nil {
 			return err
 		}
-		if area.Contains(lat, lng) && isEnterPeriod(r[PredictEclipseIndex]) && x.IsZero() {
-			if x.Starts, err = time.Parse(timeFormat, r[PredictTimeIndex]); err != nil {
-				return timeBadSyntax(i, r[PredictTimeIndex])
-			}
-		}
-		if (!area.Contains(lat, lng) || isLeavePeriod(r[PredictEclipseIndex])) && !x.IsZero() {
-			// if x.Ends, err = time.Parse(timeFormat, r[PredictTimeIndex]); err != nil {
+		// an aurora period also ends when the trajectory moves to another named area
+		name := nameOf(area, lat, lng)
+		if (!area.Contains(lat, lng) || isLeavePeriod(r[cols.Eclipse]) || name != x.Area) && !x.IsZero() {
+			// if x.Ends, err = time.Parse(TimeFormat, r[PredictTimeIndex]); err != nil {
 			// 	return timeBadSyntax(i, r[PredictTimeIndex])
 			// }
 			s.Auroras = append(s.Auroras, Period{
 				Label:  "aurora",
 				Starts: x.Starts.UTC(),
 				Ends:   last, //x.Ends.Add(-resolution).UTC(),
+				Area:   x.Area,
 			})
 			x = z
 		}
-		if isEnterPeriod(r[PredictEclipseIndex]) && e.IsZero() {
-			if e.Starts, err = time.Parse(timeFormat, r[PredictTimeIndex]); err != nil {
+		if area.Contains(lat, lng) && isEnterPeriod(r[cols.Eclipse]) && x.IsZero() {
+			if x.Starts, err = time.Parse(TimeFormat, r[PredictTimeIndex]); err != nil {
 				return timeBadSyntax(i, r[PredictTimeIndex])
 			}
+			x.Area = name
 		}
-		if isLeavePeriod(r[PredictEclipseIndex]) && !e.IsZero() {
-			// if e.Ends, err = time.Parse(timeFormat, r[PredictTimeIndex]); err != nil {
+		if isEnterPeriod(r[cols.Eclipse]) && e.IsZero() {
+			if e.Starts, err = time.Parse(TimeFormat, r[PredictTimeIndex]); err != nil {
+				return timeBadSyntax(i, r[PredictTimeIndex])
+			}
+		}
+		if isLeavePeriod(r[cols.Eclipse]) && !e.IsZero() {
+			// if e.Ends, err = time.Parse(TimeFormat, r[PredictTimeIndex]); err != nil {
 			// 	return timeBadSyntax(i, r[PredictTimeIndex])
 			// }
 			s.Eclipses = append(s.Eclipses, Period{
@@ -527,13 +1314,13 @@ func (s *Schedule) listPeriods(r io.Reader, area Shape) error {
 			})
 			e = z
 		}
-		if isEnterPeriod(r[PredictSaaIndex]) && a.IsZero() {
-			if a.Starts, err = time.Parse(timeFormat, r[PredictTimeIndex]); err != nil {
+		if isEnterPeriod(r[cols.Saa]) && a.IsZero() {
+			if a.Starts, err = time.Parse(TimeFormat, r[PredictTimeIndex]); err != nil {
 				return timeBadSyntax(i, r[PredictTimeIndex])
 			}
 		}
-		if isLeavePeriod(r[PredictSaaIndex]) && !a.IsZero() {
-			// if a.Ends, err = time.Parse(timeFormat, r[PredictTimeIndex]); err != nil {
+		if isLeavePeriod(r[cols.Saa]) && !a.IsZero() {
+			// if a.Ends, err = time.Parse(TimeFormat, r[PredictTimeIndex]); err != nil {
 			// 	return timeBadSyntax(i, r[PredictTimeIndex])
 			// }
 			s.Saas = append(s.Saas, Period{
@@ -543,13 +1330,25 @@ func (s *Schedule) listPeriods(r io.Reader, area Shape) error {
 			})
 			a = z
 		}
-		last, err = time.Parse(timeFormat, r[PredictTimeIndex])
+		now, err := time.Parse(TimeFormat, r[PredictTimeIndex])
 		if err != nil {
 			return timeBadSyntax(i, r[PredictTimeIndex])
 		}
+		if d := now.Sub(last); !last.IsZero() && (spacings[d] > 0 || len(spacings) < maxSpacings) {
+			spacings[d]++
+		}
+		last = now
 	}
+	for d, n := range spacings {
+		if c := spacings[s.Spacing]; n > c || n == c && d < s.Spacing {
+			s.Spacing = d
+		}
+	}
+	s.Eclipses = s.removeEmpty(s.Eclipses)
+	s.Saas = s.removeEmpty(s.Saas)
+	s.Auroras = s.removeEmpty(s.Auroras)
 	if len(s.Eclipses) == 0 && len(s.Saas) == 0 {
-		return fmt.Errorf("no eclipses/saas found")
+		return genericErr("no eclipses/saas found")
 	}
 	sort.Slice(s.Eclipses, func(i, j int) bool { return s.Eclipses[i].Starts.Before(s.Eclipses[j].Starts) })
 	sort.Slice(s.Saas, func(i, j int) bool { return s.Saas[i].Starts.Before(s.Saas[j].Starts) })
@@ -557,6 +1356,26 @@ func (s *Schedule) listPeriods(r io.Reader, area Shape) error {
 	return nil
 }
 
+// removeEmpty removes the periods whose end is not after their start. They
+// happen when a flag is set for a single row of the trajectory.
+func (s *Schedule) removeEmpty(ps []Period) []Period {
+	xs := ps[:0]
+	for _, p := range ps {
+		if !p.Ends.After(p.Starts) {
+			s.removed = append(s.removed, p)
+			continue
+		}
+		xs = append(xs, p)
+	}
+	return xs
+}
+
+// Removed returns the periods with a zero (or negative) duration found in the
+// trajectory and not kept in the schedule.
+func (s *Schedule) Removed() []Period {
+	return s.removed
+}
+
 func parseLatLng(r []string, i int) (float64, float64, error) {
 	lat, err := strconv.ParseFloat(r[PredictLatIndex], 64)
 	if err != nil {
@@ -582,7 +1401,11 @@ func skipEclipses(es, as []Period, cross bool, d time.Duration) []Period {
 		return d == 0 || e.Intersect(a) > d
 	}
 	for i, e := range es {
-		switch a := isCrossing(e, as, predicate); {
+		xs := as
+		if d > 0 {
+			xs = overlapping(e, xs)
+		}
+		switch a := isCrossing(e, xs, predicate); {
 		case cross && !a.IsZero():
 		case !cross && a.IsZero():
 		default:
@@ -608,6 +1431,15 @@ func isNear(a Period, es []Entry, predicate func(Entry) bool) Entry {
 
 type PeriodFunc func(Period, Period) bool
 
+// overlapping skips the periods of as (sorted and not overlapping each
+// other) that end before e starts and that can not overlap e.
+func overlapping(e Period, as []Period) []Period {
+	i := sort.Search(len(as), func(i int) bool {
+		return !as[i].Ends.Before(e.Starts)
+	})
+	return as[i:]
+}
+
 func isCrossingList(e Period, as []Period, predicate PeriodFunc) []Period {
 	var es []Period
 	for _, a := range as {
@@ -0,0 +1,1134 @@
+package assist
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)
+
+// at gives the time sec seconds after epoch.
+func at(sec int) time.Time {
+	return epoch.Add(time.Duration(sec) * time.Second)
+}
+
+func period(label string, starts, ends int) Period {
+	return Period{Label: label, Starts: at(starts), Ends: at(ends)}
+}
+
+func TestCheckGap(t *testing.T) {
+	var (
+		roc = RocOption{TimeOn: NewDuration(50), TimeOff: NewDuration(80)}
+		cer = CerOption{TimeOn: NewDuration(40), TimeOff: NewDuration(40)}
+		e   = period("eclipse", 0, 2000)
+	)
+	data := []struct {
+		Name     string
+		Ignore   bool
+		Entries  []Entry
+		When     []int
+		Conflict []string
+	}{
+		{
+			Name: "far-enough",
+			Entries: []Entry{
+				{Label: ROCON, When: at(100), Period: e},
+				{Label: CERON, When: at(200), Period: e},
+			},
+			When:     []int{100, 200},
+			Conflict: []string{"", ""},
+		},
+		{
+			Name: "too-close",
+			Entries: []Entry{
+				{Label: ROCON, When: at(100), Period: e},
+				{Label: CERON, When: at(160), Period: e},
+			},
+			When:     []int{100, 160},
+			Conflict: []string{ConflictMinGap, ConflictMinGap},
+		},
+		{
+			// CERON ends before ROCON but the running end is the end of ROCON
+			Name: "running-end",
+			Entries: []Entry{
+				{Label: ROCON, When: at(100), Period: e},
+				{Label: CERON, When: at(105), Period: e},
+				{Label: ROCOFF, When: at(170), Period: e},
+			},
+			When:     []int{100, 105, 170},
+			Conflict: []string{ConflictMinGap, ConflictMinGap, ConflictMinGap},
+		},
+		{
+			Name:   "ignore-shift",
+			Ignore: true,
+			Entries: []Entry{
+				{Label: ROCON, When: at(100), Period: e},
+				{Label: CERON, When: at(160), Period: e},
+			},
+			When:     []int{100, 180},
+			Conflict: []string{ConflictMinGap, ConflictMinGap},
+		},
+		{
+			Name:   "ignore-outside-period",
+			Ignore: true,
+			Entries: []Entry{
+				{Label: CERON, When: at(1900), Period: e},
+				{Label: ROCON, When: at(1920), Period: e},
+			},
+			When:     []int{1900, 1920},
+			Conflict: []string{ConflictMinGap, ConflictMinGap},
+		},
+		{
+			Name: "pair-offset",
+			Entries: []Entry{
+				{Label: ROCON, When: at(100), Period: e},
+				{Label: ROCOFF, When: at(120), Period: e},
+			},
+			When:     []int{100, 120},
+			Conflict: []string{"", ""},
+		},
+		{
+			// the second block is moved as a whole after the first one
+			Name:   "back-to-back-blocks",
+			Ignore: true,
+			Entries: []Entry{
+				{Label: ROCON, When: at(100), Period: e},
+				{Label: ROCOFF, When: at(200), Period: e},
+				{Label: ROCON, When: at(290), Period: e},
+				{Label: ROCOFF, When: at(390), Period: e},
+			},
+			When:     []int{100, 200, 310, 410},
+			Conflict: []string{ConflictMinGap, ConflictMinGap, ConflictMinGap, ConflictMinGap},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			s := Schedule{MinGap: 30 * time.Second, Ignore: d.Ignore}
+			es := s.checkGap(d.Entries, roc, cer, AuroraOption{})
+			for i, e := range es {
+				if !e.When.Equal(at(d.When[i])) {
+					t.Errorf("%s: want %s, got %s", e.Label, at(d.When[i]), e.When)
+				}
+				if e.Conflict != d.Conflict[i] {
+					t.Errorf("%s: want conflict %q, got %q", e.Label, d.Conflict[i], e.Conflict)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBlackouts(t *testing.T) {
+	var (
+		roc = RocOption{TimeOn: NewDuration(50), TimeOff: NewDuration(80)}
+		cer = CerOption{TimeOn: NewDuration(40), TimeOff: NewDuration(40)}
+		e   = period("eclipse", 0, 2000)
+	)
+	entries := func() []Entry {
+		return []Entry{
+			{Label: ROCON, When: at(100), Period: e},
+			{Label: CERON, When: at(300), Period: e},
+			{Label: CEROFF, When: at(400), Period: e},
+			{Label: ROCOFF, When: at(900), Period: e},
+		}
+	}
+	// the blackout only covers ROCOFF
+	blackout := period("blackout", 950, 1000)
+
+	t.Run("drop", func(t *testing.T) {
+		s := Schedule{Blackouts: []Period{blackout}}
+		es := s.checkBlackouts(entries(), roc, cer, AuroraOption{})
+		checkEntries(t, es, entries()[1:3])
+		if len(s.dropped) != 1 {
+			t.Fatalf("want 1 dropped block, got %d", len(s.dropped))
+		}
+		d := s.dropped[0]
+		if d.Label != ROCON || d.Reason != ConflictBlackout || !d.Starts.Equal(at(100)) || !d.Ends.Equal(at(980)) {
+			t.Errorf("unexpected dropped block: %+v", d)
+		}
+	})
+	t.Run("ignore", func(t *testing.T) {
+		s := Schedule{Blackouts: []Period{blackout}, Ignore: true}
+		es := s.checkBlackouts(entries(), roc, cer, AuroraOption{})
+		checkEntries(t, es, entries())
+		for _, e := range es {
+			want := ConflictBlackout
+			if e.Label == CERON || e.Label == CEROFF {
+				want = ""
+			}
+			if e.Conflict != want {
+				t.Errorf("%s: want conflict %q, got %q", e.Label, want, e.Conflict)
+			}
+		}
+		if len(s.dropped) != 0 {
+			t.Errorf("want no dropped block, got %d", len(s.dropped))
+		}
+	})
+}
+
+func TestLimitROC(t *testing.T) {
+	var (
+		roc = RocOption{MaxPerDay: 2, MaxWindow: NewDuration(90 * 60)}
+		es  []Entry
+	)
+	for _, m := range []int{20, 35, 60, 110} {
+		p := period("eclipse", m*60, m*60+600)
+		es = append(es, Entry{Label: ROCON, When: p.Starts, Period: p}, Entry{Label: ROCOFF, When: p.Starts.Add(time.Minute), Period: p})
+	}
+	// the windows start at the origin, not on the Unix epoch: the first
+	// block is alone before it and the three others are in the same window
+	s := Schedule{Origin: at(30 * 60)}
+	xs := s.limitROC(append([]Entry{}, es...), roc)
+	checkEntries(t, xs, es[:6])
+	if len(s.dropped) != 1 || !s.dropped[0].Starts.Equal(at(110*60)) {
+		t.Errorf("want the last block dropped, got %+v", s.dropped)
+	}
+
+	// aligned on the Unix epoch, the first three blocks are in the same window
+	s = Schedule{}
+	xs = s.limitROC(append([]Entry{}, es...), roc)
+	checkEntries(t, xs, append(append([]Entry{}, es[:4]...), es[6:]...))
+}
+
+func TestShiftROC(t *testing.T) {
+	roc := RocOption{
+		TimeOn:      NewDuration(50),
+		TimeOff:     NewDuration(80),
+		TimeBetween: NewDuration(120),
+		TimeAZM:     NewDuration(40),
+	}
+	data := []struct {
+		Name    string
+		Eclipse Period
+		Saa     Period
+		On, Off int
+		WantOn  int
+		WantOff int
+	}{
+		{
+			Name:    "rocoff-later",
+			Eclipse: period("eclipse", 0, 2000),
+			On:      100,
+			Off:     200,
+			WantOn:  100,
+			WantOff: 271,
+		},
+		{
+			Name:    "rocoff-later-rocon-earlier",
+			Eclipse: period("eclipse", 0, 400),
+			On:      200,
+			Off:     300,
+			WantOn:  149,
+			WantOff: 320,
+		},
+		{
+			Name:    "rocon-earlier-azm",
+			Eclipse: period("eclipse", 0, 2000),
+			Saa:     period("saa", 300, 600),
+			On:      100,
+			Off:     200,
+			WantOn:  29,
+			WantOff: 200,
+		},
+		{
+			Name:    "unrepairable",
+			Eclipse: period("eclipse", 100, 300),
+			On:      150,
+			Off:     200,
+			WantOn:  150,
+			WantOff: 200,
+		},
+		{
+			Name:    "unrepairable-azm",
+			Eclipse: period("eclipse", 100, 2000),
+			Saa:     period("saa", 300, 600),
+			On:      150,
+			Off:     200,
+			WantOn:  150,
+			WantOff: 200,
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			var (
+				on  = Entry{Label: ROCON, When: at(d.On), Period: d.Eclipse}
+				off = Entry{Label: ROCOFF, When: at(d.Off), Period: d.Eclipse}
+			)
+			on, off = shiftROC(d.Eclipse, d.Saa, d.Saa, on, off, roc)
+			if !on.When.Equal(at(d.WantOn)) {
+				t.Errorf("ROCON: want %s, got %s", at(d.WantOn), on.When)
+			}
+			if !off.When.Equal(at(d.WantOff)) {
+				t.Errorf("ROCOFF: want %s, got %s", at(d.WantOff), off.When)
+			}
+		})
+	}
+}
+
+// TestAsymmetricAZM checks that azm-enter and azm-exit shift ROCON and ROCOFF
+// differently around the same SAA (1000-1500).
+func TestAsymmetricAZM(t *testing.T) {
+	var (
+		saa = period("saa", 1000, 1500)
+		roc = RocOption{
+			TimeOn:  NewDuration(60),
+			TimeOff: NewDuration(90),
+		}
+		longExit  = RocOption{AzmEnter: NewDuration(40), AzmExit: NewDuration(100)}
+		longEnter = RocOption{AzmEnter: NewDuration(100), AzmExit: NewDuration(40)}
+	)
+	data := []struct {
+		Name  string
+		Label string
+		Wait  int
+		Ends  int
+		Azm   RocOption
+		Want  int
+	}{
+		// ROCON overlapping the enter AZM is shifted to its end
+		{Name: "rocon-enter-short", Label: ROCON, Wait: 990, Azm: longExit, Want: 1040},
+		{Name: "rocon-enter-long", Label: ROCON, Wait: 990, Azm: longEnter, Want: 1100},
+		// ROCON overlapping the exit AZM is shifted to its end
+		{Name: "rocon-exit-short", Label: ROCON, Wait: 1490, Azm: longEnter, Want: 1540},
+		{Name: "rocon-exit-long", Label: ROCON, Wait: 1490, Azm: longExit, Want: 1600},
+		// ROCOFF after the enter AZM stays, ROCOFF within it is moved before the SAA
+		{Name: "rocoff-enter-short", Label: ROCOFF, Ends: 1135, Azm: longExit, Want: 1045},
+		{Name: "rocoff-enter-long", Label: ROCOFF, Ends: 1135, Azm: longEnter, Want: 910},
+		// ROCOFF after the exit AZM stays, ROCOFF within it is moved before the SAA exit
+		{Name: "rocoff-exit-short", Label: ROCOFF, Ends: 1635, Azm: longEnter, Want: 1545},
+		{Name: "rocoff-exit-long", Label: ROCOFF, Ends: 1635, Azm: longExit, Want: 1410},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			r := roc
+			r.AzmEnter, r.AzmExit = d.Azm.AzmEnter, d.Azm.AzmExit
+			r.WaitBeforeOn = NewDuration(d.Wait)
+
+			var got Entry
+			if d.Label == ROCON {
+				got = scheduleROCON(period("eclipse", 0, 3000), saa, r, nil)
+			} else {
+				got = scheduleROCOFF(period("eclipse", 0, d.Ends), saa, r, nil)
+			}
+			if !got.When.Equal(at(d.Want)) {
+				t.Errorf("%s: want %s, got %s", d.Label, at(d.Want).Sub(epoch), got.When.Sub(epoch))
+			}
+		})
+	}
+}
+
+func TestScheduleBlockShift(t *testing.T) {
+	roc := RocOption{
+		TimeOn:       NewDuration(50),
+		TimeOff:      NewDuration(80),
+		TimeBetween:  NewDuration(120),
+		WaitBeforeOn: NewDuration(50),
+	}
+	data := []struct {
+		Name    string
+		Eclipse Period
+		Dropped string
+	}{
+		{Name: "repairable", Eclipse: period("eclipse", 0, 300)},
+		{Name: "unrepairable", Eclipse: period("eclipse", 0, 250), Dropped: ConflictRocMargin},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			s := Schedule{Conflict: ConflictShift, Eclipses: []Period{d.Eclipse}}
+			b := s.scheduleBlock(d.Eclipse, roc)
+			if b.Dropped != d.Dropped {
+				t.Fatalf("dropped: want %q, got %q", d.Dropped, b.Dropped)
+			}
+			if d.Dropped == "" && !roc.hasMargin(b.On, b.Off) {
+				t.Errorf("margin not respected: %s - %s", b.On.When, b.Off.When)
+			}
+		})
+	}
+}
+
+// openFixture reads the trajectory testdata/name with a single area covering
+// the north pole.
+func openFixture(t testing.TB, name string) *Schedule {
+	t.Helper()
+	r, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	s, err := OpenReader(r, Rect{North: 90, South: 45, West: -180, East: 180})
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	return s
+}
+
+func TestMergeSaaBeforeCER(t *testing.T) {
+	s := openFixture(t, "saa-split.csv")
+	if len(s.Saas) != 2 {
+		t.Fatalf("saa-split.csv: want 2 saas, got %d", len(s.Saas))
+	}
+	data := []struct {
+		Name string
+		Gap  time.Duration
+		Off  int
+	}{
+		{Name: "no-merge", Off: 1490 + 15},
+		{Name: "merge", Gap: 30 * time.Second, Off: 1790 + 15},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			cer := CerOption{
+				TimeOn:    NewDuration(40),
+				TimeOff:   NewDuration(40),
+				BeforeSaa: NewDuration(50),
+				AfterSaa:  NewDuration(15),
+				Algorithm: CerInside,
+				Crossing:  CrossingFirst,
+				MergeGap:  Duration{d.Gap},
+				Fileset:   Fileset{On: "ceron.txt", Off: "ceroff.txt"},
+			}
+			rs := []Entry{{Label: ROCON, When: at(0)}}
+			es, err := s.runCER(context.Background(), cer, RocOption{}, rs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(es) != 2 {
+				t.Fatalf("want 1 CERON/CEROFF pair, got %d entries", len(es))
+			}
+			if want := at(1200 - 50); !es[0].When.Equal(want) {
+				t.Errorf("CERON: want %s, got %s", want, es[0].When)
+			}
+			if want := at(d.Off); !es[1].When.Equal(want) {
+				t.Errorf("CEROFF: want %s, got %s", want, es[1].When)
+			}
+		})
+	}
+}
+
+func TestMergePeriods(t *testing.T) {
+	aurora := func(area string, starts, ends int) Period {
+		p := period("aurora", starts, ends)
+		p.Area = area
+		return p
+	}
+	s := Schedule{
+		Eclipses: []Period{period("eclipse", 0, 2000), period("eclipse", 5000, 7000)},
+		Saas:     []Period{period("saa", 100, 300), period("saa", 320, 500), period("saa", 600, 700)},
+		Auroras: []Period{
+			aurora("north", 100, 200), aurora("north", 210, 300),
+			aurora("north", 400, 500), aurora("south", 510, 600),
+		},
+	}
+	s.MergePeriods(30 * time.Second)
+
+	data := []struct {
+		Label string
+		Got   []Period
+		Want  []Period
+	}{
+		{
+			Label: "eclipse",
+			Got:   s.Eclipses,
+			Want:  []Period{period("eclipse", 0, 2000), period("eclipse", 5000, 7000)},
+		},
+		{
+			Label: "saa",
+			Got:   s.Saas,
+			Want:  []Period{period("saa", 100, 500), period("saa", 600, 700)},
+		},
+		{
+			Label: "aurora",
+			Got:   s.Auroras,
+			Want:  []Period{aurora("north", 100, 300), aurora("north", 400, 500), aurora("south", 510, 600)},
+		},
+	}
+	for _, d := range data {
+		if !reflect.DeepEqual(d.Got, d.Want) {
+			t.Errorf("%s: want %v, got %v", d.Label, d.Want, d.Got)
+		}
+	}
+}
+
+func TestForceOff(t *testing.T) {
+	roc := RocOption{
+		TimeOn:  NewDuration(50),
+		TimeOff: NewDuration(60),
+	}
+	// ACSON at the start of the aurora falls inside the ROCOFF
+	rs := []Entry{{Label: ROCOFF, When: at(-10)}}
+	data := []struct {
+		Name     string
+		ForceOff bool
+		Want     []Entry
+	}{
+		{Name: "suppressed"},
+		{Name: "force-off", ForceOff: true, Want: []Entry{{Label: ACSOFF, When: at(580)}}},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			s := Schedule{
+				Eclipses: []Period{period("", 0, 1000)},
+				Auroras:  []Period{period("", 0, 600)},
+			}
+			aur := AuroraOption{
+				Fileset:  Fileset{On: "acson.txt", Off: "acsoff.txt"},
+				Night:    NewDuration(300),
+				Time:     NewDuration(20),
+				ForceOff: d.ForceOff,
+			}
+			es, err := s.runACS(context.Background(), aur, roc, rs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(es) != len(d.Want) {
+				t.Fatalf("want %d entries, got %d", len(d.Want), len(es))
+			}
+			for i := range es {
+				if es[i].Label != d.Want[i].Label || !es[i].When.Equal(d.Want[i].When) {
+					t.Errorf("want %s at %s, got %s at %s", d.Want[i].Label, d.Want[i].When, es[i].Label, es[i].When)
+				}
+			}
+			if len(s.dropped) != 1 || s.dropped[0].Reason != ConflictAcsRocoff {
+				t.Errorf("ACSON: expected to be dropped (%s), got %v", ConflictAcsRocoff, s.dropped)
+			}
+		})
+	}
+}
+
+func TestScheduleROCONAnchor(t *testing.T) {
+	data := []struct {
+		Name   string
+		Anchor string
+		Saa    Period
+		Want   time.Time
+	}{
+		{Name: "eclipse", Anchor: AnchorEclipse, Saa: period("", 500, 800), Want: at(30)},
+		{Name: "default", Saa: period("", 500, 800), Want: at(30)},
+		{Name: "saa", Anchor: AnchorSaa, Saa: period("", 500, 800), Want: at(530)},
+		{Name: "saa-without-saa", Anchor: AnchorSaa, Want: at(30)},
+		{Name: "saa-before-eclipse", Anchor: AnchorSaa, Saa: period("", -100, 10), Want: at(30)},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			roc := RocOption{
+				TimeOn:       NewDuration(60),
+				TimeOff:      NewDuration(60),
+				TimeAZM:      NewDuration(20),
+				WaitBeforeOn: NewDuration(30),
+				Anchor:       d.Anchor,
+			}
+			got := scheduleROCON(period("", 0, 2000), d.Saa, roc, nil)
+			if !got.When.Equal(d.Want) {
+				t.Errorf("want %s, got %s", d.Want, got.When)
+			}
+		})
+	}
+}
+
+// synthetic builds a schedule of n orbits of 92 minutes with an eclipse of
+// 35 minutes each and SAA of various length crossing two orbits out of three.
+func synthetic(n int) *Schedule {
+	const orbit = 5520
+	var s Schedule
+	for k := 0; k < n; k++ {
+		starts := k * orbit
+		s.Eclipses = append(s.Eclipses, period("eclipse", starts, starts+2100))
+		if k%3 == 2 {
+			continue
+		}
+		offset := 200 + (k*437)%2400
+		s.Saas = append(s.Saas, period("saa", starts+offset, starts+offset+300+(k*97)%600))
+	}
+	return &s
+}
+
+func TestScheduleROCParallel(t *testing.T) {
+	roc := RocOption{
+		Fileset:      Fileset{On: "rocon.txt", Off: "rocoff.txt"},
+		TimeOn:       NewDuration(300),
+		TimeOff:      NewDuration(400),
+		TimeAZM:      NewDuration(60),
+		TimeBetween:  NewDuration(120),
+		WaitBeforeOn: NewDuration(30),
+	}
+	run := func(workers int) ([]Entry, []Drop, []string) {
+		var (
+			mu     sync.Mutex
+			traces []string
+		)
+		s := synthetic(500)
+		s.Workers = workers
+		s.Conflict = ConflictShift
+		s.Trace = func(e Entry, from time.Time, rule string) {
+			mu.Lock()
+			defer mu.Unlock()
+			traces = append(traces, fmt.Sprintf("%s %s %s %s", e.Label, e.When, from, rule))
+		}
+		es, err := s.runROC(context.Background(), roc)
+		if err != nil {
+			t.Fatalf("workers %d: %s", workers, err)
+		}
+		sort.Strings(traces)
+		return es, s.dropped, traces
+	}
+	es, ds, ts := run(1)
+	if len(es) == 0 || len(ts) == 0 {
+		t.Fatalf("synthetic schedule should give entries (%d) and moves (%d)", len(es), len(ts))
+	}
+	for _, w := range []int{2, 4, 16} {
+		pes, pds, pts := run(w)
+		if !reflect.DeepEqual(es, pes) {
+			t.Errorf("workers %d: entries differ from the serial schedule", w)
+		}
+		if !reflect.DeepEqual(ds, pds) {
+			t.Errorf("workers %d: dropped blocks differ from the serial schedule", w)
+		}
+		if !reflect.DeepEqual(ts, pts) {
+			t.Errorf("workers %d: traces differ from the serial schedule", w)
+		}
+	}
+}
+
+func BenchmarkScheduleROC(b *testing.B) {
+	roc := RocOption{
+		Fileset:      Fileset{On: "rocon.txt", Off: "rocoff.txt"},
+		TimeOn:       NewDuration(300),
+		TimeOff:      NewDuration(400),
+		TimeAZM:      NewDuration(60),
+		TimeBetween:  NewDuration(120),
+		WaitBeforeOn: NewDuration(30),
+	}
+	for _, w := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers-%d", w), func(b *testing.B) {
+			s := synthetic(5000)
+			s.Workers = w
+			for i := 0; i < b.N; i++ {
+				s.dropped = s.dropped[:0]
+				if _, err := s.runROC(context.Background(), roc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCrossing looks for the SAA crossing each eclipse of 3 weeks of
+// orbits, with (search) and without (scan) looking up the first candidate
+// SAA first.
+func BenchmarkCrossing(b *testing.B) {
+	var (
+		s         = synthetic(330)
+		predicate = func(e, a Period) bool { return e.Overlaps(a) }
+	)
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, e := range s.Eclipses {
+				isCrossingList(e, s.Saas, predicate)
+			}
+		}
+	})
+	b.Run("search", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, e := range s.Eclipses {
+				isCrossingList(e, overlapping(e, s.Saas), predicate)
+			}
+		}
+	})
+}
+
+func TestOverlappingCrossing(t *testing.T) {
+	var (
+		s         = synthetic(330)
+		predicate = func(e, a Period) bool { return e.Overlaps(a) }
+	)
+	for _, e := range s.Eclipses {
+		want := isCrossingList(e, s.Saas, predicate)
+		got := isCrossingList(e, overlapping(e, s.Saas), predicate)
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("%s: want %v, got %v", e.Starts, want, got)
+		}
+	}
+}
+
+func TestRemoveBlip(t *testing.T) {
+	s := openFixture(t, "saa-blip.csv")
+	if len(s.Eclipses) != 1 {
+		t.Fatalf("saa-blip.csv: want 1 eclipse, got %d", len(s.Eclipses))
+	}
+	if len(s.Saas) != 1 {
+		t.Fatalf("saa-blip.csv: want 1 saa, got %d", len(s.Saas))
+	}
+	if p := s.Saas[0]; !p.Starts.Equal(at(1500)) || !p.Ends.Equal(at(1790)) {
+		t.Errorf("saa: want %s - %s, got %s - %s", at(1500), at(1790), p.Starts, p.Ends)
+	}
+	rs := s.Removed()
+	if len(rs) != 1 {
+		t.Fatalf("want 1 period removed, got %d", len(rs))
+	}
+	if p := rs[0]; p.Label != "saa" || !p.Starts.Equal(at(1200)) || p.Duration() != 0 {
+		t.Errorf("removed: want saa at %s, got %s at %s (%s)", at(1200), p.Label, p.Starts, p.Duration())
+	}
+}
+
+func TestValidateInverted(t *testing.T) {
+	data := []struct {
+		Name string
+		Saas []Period
+		Fail bool
+	}{
+		{Name: "valid", Saas: []Period{period("saa", 100, 200)}},
+		{Name: "empty", Saas: []Period{period("saa", 100, 100)}, Fail: true},
+		{Name: "inverted", Saas: []Period{period("saa", 200, 100)}, Fail: true},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			s := Schedule{Saas: d.Saas}
+			err := s.Validate()
+			if d.Fail && err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if !d.Fail && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestScheduleFixtures(t *testing.T) {
+	roc := RocOption{
+		Fileset:      Fileset{On: "rocon.txt", Off: "rocoff.txt"},
+		TimeOn:       NewDuration(60),
+		TimeOff:      NewDuration(90),
+		TimeAZM:      NewDuration(40),
+		WaitBeforeOn: NewDuration(30),
+	}
+	cer := CerOption{
+		Fileset:   Fileset{On: "ceron.txt", Off: "ceroff.txt"},
+		TimeOn:    NewDuration(40),
+		TimeOff:   NewDuration(40),
+		BeforeSaa: NewDuration(50),
+		AfterSaa:  NewDuration(15),
+		BeforeRoc: NewDuration(20),
+		Algorithm: CerInside,
+	}
+	data := []struct {
+		Name string
+		File string
+		Cer  func(CerOption) CerOption
+		Acs  AuroraOption
+		Want []Entry
+	}{
+		{
+			Name: "one-eclipse",
+			File: "one-eclipse.csv",
+			Want: []Entry{
+				{Label: ROCON, When: at(630)},
+				{Label: ROCOFF, When: at(2600)},
+			},
+		},
+		{
+			// ROCON moved after the AZM of the SAA enter
+			Name: "eclipse-saa",
+			File: "eclipse-saa.csv",
+			Want: []Entry{
+				{Label: CERON, When: at(570)},
+				{Label: ROCON, When: at(660)},
+				{Label: CEROFF, When: at(915)},
+				{Label: ROCOFF, When: at(2600)},
+			},
+		},
+		{
+			// CERON moved before ROCON
+			Name: "eclipse-saa-cer-before-roc",
+			File: "eclipse-saa.csv",
+			Cer: func(c CerOption) CerOption {
+				c.BeforeSaa, c.TimeOn = Duration{}, NewDuration(60)
+				return c
+			},
+			Want: []Entry{
+				{Label: CERON, When: at(640)},
+				{Label: ROCON, When: at(660)},
+				{Label: CEROFF, When: at(915)},
+				{Label: ROCOFF, When: at(2600)},
+			},
+		},
+		{
+			// CER spans both SAA, ROCOFF right after the AZM of the second SAA
+			Name: "eclipse-two-saa",
+			File: "eclipse-two-saa.csv",
+			Want: []Entry{
+				{Label: CERON, When: at(570)},
+				{Label: ROCON, When: at(660)},
+				{Label: ROCOFF, When: at(2600)},
+				{Label: CEROFF, When: at(2805)},
+			},
+		},
+		{
+			// CER only around the first SAA
+			Name: "eclipse-two-saa-first",
+			File: "eclipse-two-saa.csv",
+			Cer: func(c CerOption) CerOption {
+				c.Crossing = CrossingFirst
+				return c
+			},
+			Want: []Entry{
+				{Label: CERON, When: at(570)},
+				{Label: ROCON, When: at(660)},
+				{Label: CEROFF, When: at(915)},
+				{Label: ROCOFF, When: at(2600)},
+			},
+		},
+		{
+			// aurora in the north box during the eclipse
+			Name: "aurora",
+			File: "aurora.csv",
+			Acs: AuroraOption{
+				Fileset: Fileset{On: "acson.txt", Off: "acsoff.txt"},
+				Night:   NewDuration(300),
+				Time:    NewDuration(20),
+			},
+			Want: []Entry{
+				{Label: ROCON, When: at(630)},
+				{Label: ACSON, When: at(1000)},
+				{Label: ACSOFF, When: at(1770)},
+				{Label: ROCOFF, When: at(2600)},
+			},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			var (
+				s = openFixture(t, d.File)
+				c = cer
+			)
+			if d.Cer != nil {
+				c = d.Cer(c)
+			}
+			es, err := s.Schedule(roc, c, d.Acs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEntries(t, es, d.Want)
+		})
+	}
+}
+
+func checkEntries(t *testing.T, got, want []Entry) {
+	t.Helper()
+	if len(got) != len(want) {
+		for _, e := range got {
+			t.Logf("%s: %s", e.Label, e.When.Sub(epoch))
+		}
+		t.Fatalf("want %d entries, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Label != want[i].Label || !got[i].When.Equal(want[i].When) {
+			t.Errorf("%d: want %s at %s, got %s at %s", i, want[i].Label, want[i].When.Sub(epoch), got[i].Label, got[i].When.Sub(epoch))
+		}
+	}
+}
+
+// TestOpenReaderMalformed feeds broken and randomly mutated trajectories to
+// OpenReader: it should never panic and always fail with an *Error.
+func TestOpenReaderMalformed(t *testing.T) {
+	data := []string{
+		"",
+		"\n",
+		",,,,,,,\n",
+		"2021-01-25T00:00:00\n",
+		"2021-01-25T00:00:00,59239,400,0,0\n",
+		"2021-01-25T00:00:00,59239,400,0,0,1,0,0,extra\n",
+		"2021-01-25T00:00:00,59239,400,lat,0,1,0,0\n",
+		"2021-01-25T00:00:00,59239,400,0,lng,1,0,0\n",
+		"2021-01-25T00:00:00,59239,400,NaN,Inf,1,1,0\n",
+		"not-a-time,59239,400,0,0,1,1,0\n",
+		"2021-01-25T00:00:00,59239,400,0,0,1,1,0\n\n2021-01-25T00:00:10,59239,400,0,0,0,0,0\n",
+		"\"2021-01-25T00:00:00,59239,400,0,0,1,1,0\n",
+		"2021-01-25T00:00:10,59239,400,0,0,1,1,0\n2021-01-25T00:00:00,59239,400,0,0,0,0,0\n",
+	}
+	buf, err := os.ReadFile(filepath.Join("testdata", "eclipse-saa.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		b := append([]byte(nil), buf...)
+		for j := rnd.Intn(8) + 1; j > 0; j-- {
+			switch x := rnd.Intn(len(b)); rnd.Intn(3) {
+			case 0:
+				b[x] = byte(rnd.Intn(256))
+			case 1:
+				b = append(b[:x], b[x+1:]...)
+			default:
+				b = b[:x]
+			}
+			if len(b) == 0 {
+				break
+			}
+		}
+		data = append(data, string(b))
+	}
+	for i, d := range data {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Fatalf("%d: panic %v with %q", i, err, d)
+				}
+			}()
+			_, err := OpenReader(strings.NewReader(d), Rect{North: 90, South: 45, West: -180, East: 180})
+			if err == nil {
+				return
+			}
+			if _, ok := err.(*Error); !ok {
+				t.Errorf("%d: want *Error, got %T (%s)", i, err, err)
+			}
+		}()
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	buf, err := os.ReadFile(filepath.Join("testdata", "eclipse-saa.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	for i, r := range strings.SplitAfter(string(buf), "\n") {
+		// some rows are missing and a few of them are shifted
+		switch {
+		case i > 0 && i%7 == 0:
+			continue
+		case i > 0 && i%11 == 0:
+			r = strings.Replace(r, "0.000000,", "3.000000,", 1)
+		}
+		rows = append(rows, r)
+	}
+	s, err := OpenReader(strings.NewReader(strings.Join(rows, "")), Rect{North: 90, South: 45, West: -180, East: 180})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 10 * time.Second; s.Spacing != want {
+		t.Errorf("spacing: want %s, got %s", want, s.Spacing)
+	}
+}
+
+func TestAuroraFor(t *testing.T) {
+	aur := AuroraOption{
+		Night: NewDuration(300),
+		Time:  NewDuration(20),
+		Areas: []Rect{
+			{Name: "north", Time: NewDuration(30)},
+			{Name: "south", Night: NewDuration(600)},
+			{Name: "east"},
+		},
+	}
+	data := []struct {
+		Area  string
+		Time  time.Duration
+		Night time.Duration
+	}{
+		{Area: "", Time: 20 * time.Second, Night: 300 * time.Second},
+		{Area: "north", Time: 30 * time.Second, Night: 300 * time.Second},
+		{Area: "south", Time: 20 * time.Second, Night: 600 * time.Second},
+		{Area: "east", Time: 20 * time.Second, Night: 300 * time.Second},
+		{Area: "west", Time: 20 * time.Second, Night: 300 * time.Second},
+	}
+	for _, d := range data {
+		o := aur.For(Period{Area: d.Area})
+		if o.Time.Duration != d.Time || o.Night.Duration != d.Night {
+			t.Errorf("%q: want %s/%s, got %s/%s", d.Area, d.Time, d.Night, o.Time.Duration, o.Night.Duration)
+		}
+	}
+}
+
+func TestScheduleACSAreas(t *testing.T) {
+	roc := RocOption{
+		Fileset: Fileset{On: "rocon.txt", Off: "rocoff.txt"},
+		TimeOn:  NewDuration(60),
+		TimeOff: NewDuration(90),
+	}
+	aur := AuroraOption{
+		Fileset: Fileset{On: "acson.txt", Off: "acsoff.txt"},
+		Night:   NewDuration(300),
+		Time:    NewDuration(20),
+		Areas: []Rect{
+			{Name: "north", Time: NewDuration(30)},
+			{Name: "south", Time: NewDuration(60), Night: NewDuration(600)},
+		},
+	}
+	s := Schedule{
+		Eclipses: []Period{
+			period("eclipse", 0, 2000),
+			period("eclipse", 6000, 8000),
+			period("eclipse", 12000, 14000),
+		},
+		Auroras: []Period{
+			{Label: "aurora", Starts: at(500), Ends: at(1500), Area: "north"},
+			{Label: "aurora", Starts: at(6500), Ends: at(7500), Area: "south"},
+			// longer than min-aurora-duration but not than the one of south
+			{Label: "aurora", Starts: at(12500), Ends: at(12900), Area: "south"},
+		},
+	}
+	es, err := s.Schedule(roc, CerOption{}, aur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{Label: ROCON, When: at(0)},
+		{Label: ACSON, When: at(500)},
+		{Label: ACSOFF, When: at(1470)},
+		{Label: ROCOFF, When: at(1910)},
+		{Label: ROCON, When: at(6000)},
+		{Label: ACSON, When: at(6500)},
+		{Label: ACSOFF, When: at(7440)},
+		{Label: ROCOFF, When: at(7910)},
+		{Label: ROCON, When: at(12000)},
+		{Label: ROCOFF, When: at(13910)},
+	}
+	checkEntries(t, es, want)
+	for _, e := range es {
+		if e.Label != ACSON && e.Label != ACSOFF {
+			continue
+		}
+		if got, want := EntryDuration(e, roc, CerOption{}, aur), aur.For(e.Period).Time.Duration; got != want {
+			t.Errorf("%s at %s: want duration %s, got %s", e.Label, e.When.Sub(epoch), want, got)
+		}
+	}
+}
+
+// TestScheduleClassicCER checks that the classic algorithm switches CER before
+// entering the eclipses where the crossing of the SAA changes.
+func TestScheduleClassicCER(t *testing.T) {
+	cer := CerOption{
+		Fileset:         Fileset{On: "ceron.txt", Off: "ceroff.txt"},
+		TimeOn:          NewDuration(60),
+		TimeOff:         NewDuration(60),
+		SwitchTime:      NewDuration(1),
+		SaaCrossingTime: NewDuration(1),
+	}
+	s := Schedule{
+		Eclipses: []Period{
+			period("eclipse", 1000, 3000),   // N1: no SAA
+			period("eclipse", 6000, 8000),   // N2: crossing
+			period("eclipse", 11000, 13000), // N3: crossing
+			period("eclipse", 16000, 18000), // N4: no SAA
+			period("eclipse", 21000, 23000), // N5: crossing for 30s only
+		},
+		Saas: []Period{
+			period("saa", 6500, 7000),
+			period("saa", 11500, 12000),
+			period("saa", 22970, 23300),
+		},
+	}
+	data := []struct {
+		Name string
+		Cer  func(CerOption) CerOption
+		Want []Entry
+	}{
+		{
+			Name: "switch-time",
+			Want: []Entry{
+				{Label: CEROFF, When: at(940)},
+				{Label: CERON, When: at(5940)},
+				{Label: CEROFF, When: at(15940)},
+				{Label: CERON, When: at(20940)},
+			},
+		},
+		{
+			Name: "algorithm",
+			Cer: func(c CerOption) CerOption {
+				c.SwitchTime, c.Algorithm = Duration{}, CerClassic
+				return c
+			},
+			Want: []Entry{
+				{Label: CEROFF, When: at(940)},
+				{Label: CERON, When: at(5940)},
+				{Label: CEROFF, When: at(15940)},
+				{Label: CERON, When: at(20940)},
+			},
+		},
+		{
+			// N5 overlaps the SAA for less than crossing
+			Name: "crossing",
+			Cer: func(c CerOption) CerOption {
+				c.SaaCrossingTime = NewDuration(60)
+				return c
+			},
+			Want: []Entry{
+				{Label: CEROFF, When: at(940)},
+				{Label: CERON, When: at(5940)},
+				{Label: CEROFF, When: at(15940)},
+			},
+		},
+	}
+	for _, d := range data {
+		t.Run(d.Name, func(t *testing.T) {
+			c := cer
+			if d.Cer != nil {
+				c = d.Cer(c)
+			}
+			// the classic algorithm does not need ROC
+			es, err := s.ScheduleCER(c, RocOption{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEntries(t, es, d.Want)
+		})
+	}
+	for _, d := range []struct {
+		File string
+		Want Entry
+	}{
+		{File: "one-eclipse.csv", Want: Entry{Label: CEROFF, When: at(540)}},
+		{File: "eclipse-saa.csv", Want: Entry{Label: CERON, When: at(540)}},
+	} {
+		s := openFixture(t, d.File)
+		es, err := s.ScheduleCER(cer, RocOption{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEntries(t, es, []Entry{d.Want})
+	}
+}
+
+// TestClassicCERZeroCrossing documents the classic algorithm with a zero
+// saa-crossing-time: any SAA of the trajectory, even one between two eclipses,
+// makes every eclipse crossing. Only the first one gets a CERON.
+func TestClassicCERZeroCrossing(t *testing.T) {
+	cer := CerOption{
+		Fileset:   Fileset{On: "ceron.txt", Off: "ceroff.txt"},
+		TimeOn:    NewDuration(60),
+		TimeOff:   NewDuration(60),
+		Algorithm: CerClassic,
+	}
+	s := Schedule{
+		Eclipses: []Period{
+			period("eclipse", 1000, 3000),
+			period("eclipse", 6000, 8000),
+			period("eclipse", 11000, 13000),
+		},
+		Saas: []Period{
+			period("saa", 4000, 4500),
+		},
+	}
+	es, err := s.ScheduleCER(cer, RocOption{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, es, []Entry{{Label: CERON, When: at(940)}})
+
+	// without SAA, no eclipse crosses
+	s.Saas = nil
+	es, err = s.ScheduleCER(cer, RocOption{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, es, []Entry{{Label: CEROFF, When: at(940)}})
+}
@@ -1,14 +1,15 @@
-package main
+package assist
 
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var (
-	rocDefault = RocOption{
+	RocDefault = RocOption{
 		TimeSAA:      NewDuration(10),
 		TimeAZM:      NewDuration(40),
 		TimeOn:       NewDuration(50),
@@ -16,7 +17,7 @@ var (
 		TimeBetween:  NewDuration(120),
 		WaitBeforeOn: NewDuration(100),
 	}
-	cerDefault = CerOption{
+	CerDefault = CerOption{
 		SwitchTime:      NewDuration(0),
 		SaaCrossingTime: NewDuration(120),
 		BeforeSaa:       NewDuration(50),
@@ -26,7 +27,7 @@ var (
 		TimeOn:          NewDuration(40),
 		TimeOff:         NewDuration(40),
 	}
-	aurDefault = AuroraOption{
+	AuroraDefault = AuroraOption{
 		Night: NewDuration(180),
 		Time:  NewDuration(5),
 	}
@@ -42,15 +43,94 @@ const (
 )
 
 const (
-	ALLIOP = "alliop.txt"
-	INSTR  = "instrlist.txt"
+	ConflictDrop   = "drop"
+	ConflictIgnore = "ignore"
+	ConflictShift  = "shift"
 )
 
-var (
-	ExecutionTime   time.Time
-	DefaultBaseTime time.Time
+func CheckConflict(mode string) error {
+	switch mode {
+	case "", ConflictDrop, ConflictIgnore, ConflictShift:
+		return nil
+	default:
+		return BadUsage(fmt.Sprintf("%s: unknown conflict mode", mode))
+	}
+}
+
+const (
+	RuleEarliest = "earliest"
+	RuleLongest  = "longest"
+)
+
+func CheckMaxRule(rule string) error {
+	switch rule {
+	case "", RuleEarliest, RuleLongest:
+		return nil
+	default:
+		return BadUsage(fmt.Sprintf("%s: unknown max-per-day-rule", rule))
+	}
+}
+
+const (
+	CrossingFirst   = "first"
+	CrossingLast    = "last"
+	CrossingLongest = "longest"
+)
+
+const (
+	AnchorEclipse = "eclipse"
+	AnchorSaa     = "saa"
+)
+
+func CheckAnchor(anchor string) error {
+	switch anchor {
+	case "", AnchorEclipse, AnchorSaa:
+		return nil
+	default:
+		return BadUsage(fmt.Sprintf("%s: unknown wait-anchor", anchor))
+	}
+}
+
+const (
+	AcceptNight      = "night"
+	AcceptNightOnOff = "night-onoff"
+)
+
+func CheckAccept(rule string) error {
+	switch rule {
+	case "", AcceptNight, AcceptNightOnOff:
+		return nil
+	default:
+		return BadUsage(fmt.Sprintf("%s: unknown accept rule", rule))
+	}
+}
+
+const (
+	CerClassic = "classic"
+	CerInside  = "inside"
+	CerSaa     = "saa"
 )
 
+func CheckAlgorithm(algo string) error {
+	switch algo {
+	case "", CerClassic, CerInside, CerSaa:
+		return nil
+	default:
+		return BadUsage(fmt.Sprintf("%s: unknown CER algorithm", algo))
+	}
+}
+
+func CheckCrossing(rule string) error {
+	switch rule {
+	case "", CrossingFirst, CrossingLast, CrossingLongest:
+		return nil
+	default:
+		return BadUsage(fmt.Sprintf("%s: unknown saa-select rule", rule))
+	}
+}
+
+const MaxEclipseDuration = 40 * time.Minute
+
 type Shape interface {
 	IsZero() bool
 	Contains(float64, float64) bool
@@ -58,14 +138,30 @@ type Shape interface {
 }
 
 type Rect struct {
+	Name  string  `toml:"name"`
 	North float64 `toml:"north"`
 	South float64 `toml:"south"`
 	West  float64 `toml:"west"`
 	East  float64 `toml:"east"`
+
+	// overrides of the ACS options for the aurora periods found in the area
+	Time  Duration `toml:"duration"`
+	Night Duration `toml:"min-aurora-duration"`
 }
 
 func (r Rect) String() string {
-	return fmt.Sprintf("%.0fN %.0fS %.0fW %.0fE", r.North, r.South, r.East, r.West)
+	str := fmt.Sprintf("%.0fN %.0fS %.0fW %.0fE", r.North, r.South, r.East, r.West)
+	if r.Name != "" {
+		str = r.Name + ": " + str
+	}
+	return str
+}
+
+func (r Rect) NameOf(lat, lng float64) string {
+	if !r.Contains(lat, lng) {
+		return ""
+	}
+	return r.Name
 }
 
 func (r Rect) IsZero() bool {
@@ -73,16 +169,56 @@ func (r Rect) IsZero() bool {
 }
 
 func (r Rect) Contains(lat, lng float64) bool {
-	if r.IsZero() || !r.isValid() {
+	if r.IsZero() || !r.IsValid() {
 		return false
 	}
 	return lat <= r.North && lat >= r.South && lng <= r.East && lng >= r.West
 }
 
-func (r Rect) isValid() bool {
+func (r Rect) IsValid() bool {
 	return r.South < r.North && r.West < r.East
 }
 
+func ParseRect(str string) (Rect, error) {
+	var (
+		r     Rect
+		coord = str
+	)
+	if x := strings.Index(str, ":"); x >= 0 {
+		r.Name, coord = strings.TrimSpace(str[:x]), str[x+1:]
+	}
+	ps := strings.Split(coord, ",")
+	if len(ps) != 4 {
+		return r, BadUsage(fmt.Sprintf("%s: area should be given as [NAME:]N,S,W,E", str))
+	}
+	vs := []*float64{&r.North, &r.South, &r.West, &r.East}
+	for i, p := range ps {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return r, BadUsage(fmt.Sprintf("%s: invalid coordinate (%s)", str, p))
+		}
+		*vs[i] = v
+	}
+	if r.IsZero() || !r.IsValid() {
+		return r, BadUsage(fmt.Sprintf("%s: invalid area", str))
+	}
+	return r, nil
+}
+
+type Rects []Rect
+
+func (rs *Rects) String() string {
+	return fmt.Sprint(*rs)
+}
+
+func (rs *Rects) Set(str string) error {
+	r, err := ParseRect(str)
+	if err == nil {
+		*rs = append(*rs, r)
+	}
+	return err
+}
+
 type Area struct {
 	shapes []Shape
 }
@@ -124,6 +260,29 @@ func (a Area) Contains(lat, lng float64) bool {
 	return false
 }
 
+// NameOf gives the name of the first shape of a containing the given point.
+func (a Area) NameOf(lat, lng float64) string {
+	for _, s := range a.shapes {
+		if s.Contains(lat, lng) {
+			return nameOf(s, lat, lng)
+		}
+	}
+	return ""
+}
+
+// Named is implemented by the shapes that can give a name to the points they
+// contain.
+type Named interface {
+	NameOf(float64, float64) string
+}
+
+func nameOf(s Shape, lat, lng float64) string {
+	if n, ok := s.(Named); ok {
+		return n.NameOf(lat, lng)
+	}
+	return ""
+}
+
 type Duration struct {
 	time.Duration
 }
@@ -152,21 +311,60 @@ func (d *Duration) Set(s string) error {
 type Fileset struct {
 	On  string `toml:"on-cmd-file"`
 	Off string `toml:"off-cmd-file"`
+
+	// commands given inline in the configuration. When set, On and Off are
+	// only the names used to refer to them (see Inline)
+	OnCmd  string `toml:"on-cmd"`
+	OffCmd string `toml:"off-cmd"`
 }
 
 func (f Fileset) IsEmpty() bool {
-	return f.On == "" && f.Off == ""
+	return f.On == "" && f.Off == "" && f.OnCmd == "" && f.OffCmd == ""
+}
+
+// Inline gives a name to the commands given inline so that they can be
+// referred to like the commands of a file.
+func (f Fileset) Inline(section string) (Fileset, error) {
+	if f.OnCmd != "" {
+		if f.On != "" {
+			return f, BadUsage(fmt.Sprintf("%s: on-cmd and on-cmd-file can not be used together", section))
+		}
+		f.On = section + ".on-cmd"
+	}
+	if f.OffCmd != "" {
+		if f.Off != "" {
+			return f, BadUsage(fmt.Sprintf("%s: off-cmd and off-cmd-file can not be used together", section))
+		}
+		f.Off = section + ".off-cmd"
+	}
+	return f, nil
 }
 
 func (f Fileset) Check() error {
 	if f.On == f.Off {
 		return sameFile("cmd-file")
 	}
-	if i, err := os.Stat(f.On); err != nil || !i.Mode().IsRegular() {
-		return missingFile(f.On)
+	if f.OnCmd != "" && f.OnCmd == f.OffCmd {
+		return sameFile("cmd-file")
 	}
-	if i, err := os.Stat(f.Off); err != nil || !i.Mode().IsRegular() {
-		return missingFile(f.Off)
+	var on, off os.FileInfo
+	if f.OnCmd == "" {
+		i, err := os.Stat(f.On)
+		if err != nil || !i.Mode().IsRegular() {
+			return MissingFile(f.On)
+		}
+		on = i
+	}
+	if f.OffCmd == "" {
+		i, err := os.Stat(f.Off)
+		if err != nil || !i.Mode().IsRegular() {
+			return MissingFile(f.Off)
+		}
+		off = i
+	}
+	// paths can differ but still point to the same file (links, relative paths...)
+	if on != nil && off != nil && os.SameFile(on, off) {
+		return sameFile("cmd-file")
 	}
 	return nil
 }
@@ -180,16 +378,105 @@ type RocOption struct {
 
 	TimeSAA      Duration `toml:"saa-duration"`
 	TimeAZM      Duration `toml:"azm-duration"`
+	AzmEnter     Duration `toml:"azm-enter"`
+	AzmExit      Duration `toml:"azm-exit"`
 	TimeOn       Duration `toml:"on-duration"`
 	TimeOff      Duration `toml:"off-duration"`
 	TimeBetween  Duration `toml:"time-between-onoff"`
 	WaitBeforeOn Duration `toml:"wait-before-on"`
+
+	Crossing string `toml:"saa-select"`
+	Anchor   string `toml:"wait-anchor"`
+
+	MaxPerDay int      `toml:"max-per-day"`
+	MaxRule   string   `toml:"max-per-day-rule"`
+	MaxWindow Duration `toml:"max-per-day-window"`
+
+	Daylight bool     `toml:"in-daylight"`
+	Offset   Duration `toml:"start-offset"`
+}
+
+// EnterAZM gives the duration of the AZM when entering the SAA: azm-enter or
+// azm-duration when not set.
+func (r RocOption) EnterAZM() time.Duration {
+	if r.AzmEnter.IsZero() {
+		return r.TimeAZM.Duration
+	}
+	return r.AzmEnter.Duration
+}
+
+// ExitAZM gives the duration of the AZM when leaving the SAA: azm-exit or
+// azm-duration when not set.
+func (r RocOption) ExitAZM() time.Duration {
+	if r.AzmExit.IsZero() {
+		return r.TimeAZM.Duration
+	}
+	return r.AzmExit.Duration
 }
 
 func (r RocOption) Can() bool {
 	return r.Fileset.Can() && !r.TimeOn.IsZero() && !r.TimeOff.IsZero()
 }
 
+func (r RocOption) Inconsistencies() []string {
+	var ws []string
+	if r.WaitBeforeOn.Duration < 0 {
+		ws = append(ws, "wait-before-on is negative")
+	}
+	if r.TimeOn.Duration < 0 || r.TimeOff.Duration < 0 || r.TimeAZM.Duration < 0 || r.TimeBetween.Duration < 0 {
+		ws = append(ws, "negative durations found")
+	}
+	if r.AzmEnter.Duration < 0 || r.AzmExit.Duration < 0 {
+		ws = append(ws, "negative AZM durations found")
+	}
+	if azm := r.ExitAZM(); r.TimeOff.Duration < azm {
+		ws = append(ws, fmt.Sprintf("off-duration (%s) shorter than the SAA exit AZM (%s)", r.TimeOff.Duration, azm))
+	}
+	if d := r.WaitBeforeOn.Duration + r.TimeOn.Duration + r.TimeBetween.Duration + r.TimeOff.Duration; d > MaxEclipseDuration {
+		ws = append(ws, fmt.Sprintf("ROCON/ROCOFF block (%s) longer than an eclipse (%s)", d, MaxEclipseDuration))
+	}
+	return ws
+}
+
+// azmWindows gives the windows of the AZM around the SAA s: one window for a
+// short SAA, one when entering and one when leaving it otherwise.
+func (r RocOption) azmWindows(s Period) []Period {
+	if s.IsZero() {
+		return nil
+	}
+	if !r.TimeSAA.IsZero() && s.Duration() <= r.TimeSAA.Duration {
+		return []Period{{Starts: s.Starts, Ends: s.Starts.Add(r.EnterAZM() + r.ExitAZM())}}
+	}
+	return []Period{
+		{Starts: s.Starts, Ends: s.Starts.Add(r.EnterAZM())},
+		{Starts: s.Ends, Ends: s.Ends.Add(r.ExitAZM())},
+	}
+}
+
+// inAZM reports whether a command starting at when and lasting d overlaps the
+// AZM of one of the SAA ss.
+func (r RocOption) inAZM(when time.Time, d time.Duration, ss ...Period) bool {
+	for _, s := range ss {
+		for _, w := range r.azmWindows(s) {
+			if when.Before(w.Ends) && w.Starts.Before(when.Add(d)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r RocOption) hasMargin(on, off Entry) bool {
+	if r.TimeBetween.IsZero() {
+		return true
+	}
+	return off.When.Sub(on.When.Add(r.TimeOn.Duration)) > r.TimeBetween.Duration
+}
+
+func (r RocOption) hasOrder(on, off Entry) bool {
+	return !off.When.Before(on.When) && off.When.Sub(on.When) > r.TimeOn.Duration
+}
+
 type CerOption struct {
 	Fileset
 
@@ -202,13 +489,39 @@ type CerOption struct {
 	AfterRoc  Duration `toml:"time-after-roc"`
 
 	SaaCrossingTime Duration `toml:"saa-crossing-time"`
-	SwitchTime      Duration `toml:"switch-onoff-time"`
+	SwitchTime      Duration `toml:"switch-onoff-time"` // selects the classic algorithm when not zero
+	MergeGap        Duration `toml:"saa-merge-gap"`
+	Crossing        string   `toml:"saa-select"`
+	Algorithm       string   `toml:"algorithm"`
+	MinOn           Duration `toml:"min-on-duration"`
+	Offset          Duration `toml:"start-offset"`
 }
 
 func (c CerOption) Can() bool {
 	return c.Fileset.Can()
 }
 
+func (c CerOption) Inconsistencies() []string {
+	var ws []string
+	ds := []Duration{c.TimeOn, c.TimeOff, c.BeforeSaa, c.AfterSaa, c.BeforeRoc, c.AfterRoc, c.SwitchTime}
+	for _, d := range ds {
+		if d.Duration < 0 {
+			ws = append(ws, "negative durations found")
+			break
+		}
+	}
+	if c.BeforeSaa.Duration > c.SaaCrossingTime.Duration {
+		ws = append(ws, fmt.Sprintf("time-before-saa (%s) larger than saa-crossing-time (%s)", c.BeforeSaa.Duration, c.SaaCrossingTime.Duration))
+	}
+	if c.SaaCrossingTime.Duration > MaxEclipseDuration {
+		ws = append(ws, fmt.Sprintf("saa-crossing-time (%s) longer than an eclipse (%s)", c.SaaCrossingTime.Duration, MaxEclipseDuration))
+	}
+	return ws
+}
+
+// AuroraOption configures ACS. Time is the only duration used for ACSON and
+// ACSOFF: TimeBetween is accepted in the configuration but not used to
+// schedule ACS.
 type AuroraOption struct {
 	Fileset
 
@@ -216,14 +529,77 @@ type AuroraOption struct {
 	Time        Duration `toml:"duration"`
 	TimeBetween Duration `toml:"time-between-onoff"`
 	Areas       []Rect   `toml:"areas"`
+	ForceOff    bool     `toml:"force-off"`
+	AcceptRule  string   `toml:"accept"`
+	WithoutRoc  bool     `toml:"without-roc"`
+	Offset      Duration `toml:"start-offset"`
 }
 
 func (a AuroraOption) Can() bool {
 	return a.Fileset.Can() && !a.Night.IsZero() && len(a.Areas) > 0
 }
 
+func (a AuroraOption) Inconsistencies() []string {
+	var ws []string
+	if a.Night.Duration < 0 || a.Time.Duration < 0 || a.TimeBetween.Duration < 0 {
+		ws = append(ws, "negative durations found")
+	}
+	if 2*a.Time.Duration > a.Night.Duration {
+		ws = append(ws, fmt.Sprintf("ACSON/ACSOFF (2x%s) longer than min-aurora-duration (%s)", a.Time.Duration, a.Night.Duration))
+	}
+	if a.Night.Duration > MaxEclipseDuration {
+		ws = append(ws, fmt.Sprintf("min-aurora-duration (%s) longer than an eclipse (%s)", a.Night.Duration, MaxEclipseDuration))
+	}
+	if !a.TimeBetween.IsZero() {
+		ws = append(ws, fmt.Sprintf("time-between-onoff (%s) is not used for ACS, only duration (%s) is", a.TimeBetween.Duration, a.Time.Duration))
+	}
+	for i, r := range a.Areas {
+		if r.Time.IsZero() && r.Night.IsZero() {
+			continue
+		}
+		if r.Name == "" {
+			ws = append(ws, fmt.Sprintf("area #%d: durations are only used for named areas", i+1))
+			continue
+		}
+		if r.Time.Duration < 0 || r.Night.Duration < 0 {
+			ws = append(ws, fmt.Sprintf("area %s: negative durations found", r.Name))
+		}
+		o := a.For(Period{Area: r.Name})
+		if 2*o.Time.Duration > o.Night.Duration {
+			ws = append(ws, fmt.Sprintf("area %s: ACSON/ACSOFF (2x%s) longer than min-aurora-duration (%s)", r.Name, o.Time.Duration, o.Night.Duration))
+		}
+	}
+	return ws
+}
+
+// For gives the options used to schedule ACS for p: the duration and
+// min-aurora-duration of the area where p has been found replace the ones of a
+// when they are set.
+func (a AuroraOption) For(p Period) AuroraOption {
+	if p.Area == "" {
+		return a
+	}
+	for _, r := range a.Areas {
+		if r.Name != p.Area {
+			continue
+		}
+		if !r.Time.IsZero() {
+			a.Time = r.Time
+		}
+		if !r.Night.IsZero() {
+			a.Night = r.Night
+		}
+		break
+	}
+	return a
+}
+
+// Accept reports whether ACS can be scheduled for p. With the night-onoff
+// rule, p should also leave room for ACSON and ACSOFF after min-aurora-duration.
 func (a AuroraOption) Accept(p Period) bool {
-	// return p.Duration() >= (a.Night.Duration + 2*a.Time.Duration)
+	if a.AcceptRule == AcceptNightOnOff {
+		return p.Duration() >= (a.Night.Duration + 2*a.Time.Duration)
+	}
 	return p.Duration() >= a.Night.Duration
 }
 